@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SeverityMapping maps the severity of an original alert rule to the severity of its
+// absence alert rules.
+type SeverityMapping struct {
+	// Source is the severity of the original alert rule.
+	Source string `json:"source"`
+	// Target is the severity of the absence alert rule.
+	Target string `json:"target"`
+}
+
+// AbsenceRulePolicySpec specifies how absence alert rules are generated for the
+// PrometheusRules that a policy applies to.
+//
+// All fields are optional. Fields that are not set do not change the configuration that
+// would otherwise be used.
+type AbsenceRulePolicySpec struct {
+	// PrometheusRuleSelector selects the PrometheusRules that this policy applies to. An
+	// empty or missing selector selects all PrometheusRules.
+	// +optional
+	PrometheusRuleSelector *metav1.LabelSelector `json:"prometheusRuleSelector,omitempty"`
+
+	// Disabled specifies whether absence alert rules are generated for the selected
+	// PrometheusRules. It can be used to disable the operator for a set of
+	// PrometheusRules or to enable it again for a subset of them.
+	// +optional
+	Disabled *bool `json:"disabled,omitempty"`
+
+	// KeepLabels is the list of labels that are retained from the original alert rule.
+	// It replaces the list that is configured with the '--keep-labels' flag.
+	// +optional
+	KeepLabels []string `json:"keepLabels,omitempty"`
+	// KeepLabelMatchers specifies whether equality label matchers are retained from the
+	// original alert rule expression.
+	// +optional
+	KeepLabelMatchers *bool `json:"keepLabelMatchers,omitempty"`
+
+	// SeverityMap maps the severity of the original alert rules to the severity of
+	// absence alert rules. The order specifies the priority if multiple alert rules use
+	// the same metric. It replaces the map that is configured with the '--severity-map'
+	// flag.
+	// +optional
+	SeverityMap []SeverityMapping `json:"severityMap,omitempty"`
+
+	// AbsenceMode is the function used in absence alert rule expressions.
+	// +kubebuilder:validation:Enum=absent;over_time
+	// +optional
+	AbsenceMode string `json:"absenceMode,omitempty"`
+	// AbsenceRange is the range used with the 'over_time' absence mode.
+	// +optional
+	AbsenceRange string `json:"absenceRange,omitempty"`
+	// AbsenceFor is the 'for' duration of absence alert rules.
+	// +optional
+	AbsenceFor string `json:"absenceFor,omitempty"`
+	// AbsenceForPolicy specifies how the 'for' duration of absence alert rules is
+	// derived from the original alert rule: 'fixed', 'max', or 'multiply:<factor>'.
+	// +optional
+	AbsenceForPolicy string `json:"absenceForPolicy,omitempty"`
+
+	// SkipMetrics is a list of metric name patterns for which no absence alert rules
+	// are generated. The patterns are added to the ones from the '--skip-metrics' flag.
+	// +optional
+	SkipMetrics []string `json:"skipMetrics,omitempty"`
+	// OnlyMetrics is a list of metric name patterns. If provided, absence alert rules
+	// are only generated for metrics that match any of these patterns. The patterns are
+	// added to the ones from the '--only-metrics' flag.
+	// +optional
+	OnlyMetrics []string `json:"onlyMetrics,omitempty"`
+
+	// PrometheusRuleName is the template for the name of the AbsencePrometheusRule that
+	// aggregates the absence alert rules of the selected PrometheusRules.
+	// +optional
+	PrometheusRuleName string `json:"prometheusRuleName,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// AbsenceRulePolicy configures the generation of absence alert rules for the
+// PrometheusRules in its namespace.
+type AbsenceRulePolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec AbsenceRulePolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// AbsenceRulePolicyList contains a list of AbsenceRulePolicy.
+type AbsenceRulePolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AbsenceRulePolicy `json:"items"`
+}
+
+// ClusterAbsenceRulePolicySpec is the AbsenceRulePolicySpec of a
+// ClusterAbsenceRulePolicy.
+type ClusterAbsenceRulePolicySpec struct {
+	AbsenceRulePolicySpec `json:",inline"`
+
+	// NamespaceSelector selects the namespaces of the PrometheusRules that this policy
+	// applies to. An empty or missing selector selects all namespaces.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// ClusterAbsenceRulePolicy configures the generation of absence alert rules for the
+// PrometheusRules across all namespaces. AbsenceRulePolicies take precedence over it.
+type ClusterAbsenceRulePolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ClusterAbsenceRulePolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterAbsenceRulePolicyList contains a list of ClusterAbsenceRulePolicy.
+type ClusterAbsenceRulePolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterAbsenceRulePolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AbsenceRulePolicy{}, &AbsenceRulePolicyList{})
+	SchemeBuilder.Register(&ClusterAbsenceRulePolicy{}, &ClusterAbsenceRulePolicyList{})
+}
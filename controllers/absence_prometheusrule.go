@@ -6,18 +6,23 @@ package controllers
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
+	"slices"
 	"sort"
-	"strings"
 	"text/template"
+	"text/template/parse"
 	"time"
 
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -26,42 +31,83 @@ const (
 	DefaultAbsencePromRuleNameTemplate = `{{ if index .metadata.labels "thanos-ruler" }}{{ index .metadata.labels "thanos-ruler" }}{{ else }}{{ index .metadata.labels "prometheus" }}{{ end }}`
 )
 
-// AbsencePromRuleNameGenerator is a function type that takes a PrometheusRule and
-// generates a name for its corresponding PrometheusRule that holds the generated absence
-// alert rules.
-type AbsencePromRuleNameGenerator func(*monitoringv1.PrometheusRule) (string, error)
+// AbsencePromRuleNameGenerator takes a PrometheusRule and generates a name for its
+// corresponding PrometheusRule that holds the generated absence alert rules.
+type AbsencePromRuleNameGenerator struct {
+	t        *template.Template
+	oneToOne bool
+}
 
-// CreateAbsencePromRuleNameGenerator creates an absencePromRuleNameGenerator function
-// based on a template string.
-func CreateAbsencePromRuleNameGenerator(tmplStr string) (AbsencePromRuleNameGenerator, error) {
+// CreateAbsencePromRuleNameGenerator creates an AbsencePromRuleNameGenerator based on a
+// template string.
+func CreateAbsencePromRuleNameGenerator(tmplStr string) (*AbsencePromRuleNameGenerator, error) {
 	t, err := template.New("promRuleNameGenerator").Option("missingkey=error").Parse(tmplStr)
 	if err != nil {
 		return nil, err
 	}
+	return &AbsencePromRuleNameGenerator{t: t, oneToOne: isOneToOneTemplate(t.Tree)}, nil
+}
 
-	return func(pr *monitoringv1.PrometheusRule) (string, error) {
-		// only a specific vetted subset of attributes is passed into the name template to avoid surprising behavior
-		meta := pr.ObjectMeta
-		data := map[string]any{
-			"metadata": map[string]any{
-				"annotations": meta.Annotations,
-				"labels":      meta.Labels,
-				"namespace":   meta.Namespace,
-				"name":        meta.Name,
-			},
-		}
+// Generate returns the name of the AbsencePrometheusRule for the given PrometheusRule.
+func (g *AbsencePromRuleNameGenerator) Generate(pr *monitoringv1.PrometheusRule) (string, error) {
+	// only a specific vetted subset of attributes is passed into the name template to avoid surprising behavior
+	data := map[string]any{
+		"metadata": promRuleMetadata(pr.ObjectMeta),
+	}
 
-		var buf bytes.Buffer
-		err = t.Execute(&buf, data)
-		if err != nil {
-			return "", fmt.Errorf("could not generate AbsencePrometheusRule name: %w", err)
-		}
+	var buf bytes.Buffer
+	err := g.t.Execute(&buf, data)
+	if err != nil {
+		return "", fmt.Errorf("could not generate AbsencePrometheusRule name: %w", err)
+	}
+
+	return buf.String() + absencePromRuleNameSuffix, nil
+}
+
+// IsOneToOne returns true if the template provably generates a distinct name for each
+// PrometheusRule in a namespace, i.e. each AbsencePrometheusRule holds the absence alert
+// rules of exactly one PrometheusRule.
+//
+// This is the case if the template only consists of text and references to
+// '.metadata.name' and '.metadata.namespace', with at least one reference to
+// '.metadata.name'. The namespace is the same for all PrometheusRules that share an
+// AbsencePrometheusRule.
+func (g *AbsencePromRuleNameGenerator) IsOneToOne() bool {
+	return g.oneToOne
+}
 
-		return buf.String() + absencePromRuleNameSuffix, nil
-	}, nil
+func isOneToOneTemplate(tree *parse.Tree) bool {
+	if tree == nil || tree.Root == nil {
+		return false
+	}
+	usesName := false
+	for _, node := range tree.Root.Nodes {
+		switch n := node.(type) {
+		case *parse.TextNode:
+			continue
+		case *parse.ActionNode:
+			if len(n.Pipe.Decl) > 0 || len(n.Pipe.Cmds) != 1 || len(n.Pipe.Cmds[0].Args) != 1 {
+				return false
+			}
+			field, ok := n.Pipe.Cmds[0].Args[0].(*parse.FieldNode)
+			if !ok || len(field.Ident) != 2 || field.Ident[0] != "metadata" {
+				return false
+			}
+			switch field.Ident[1] {
+			case "name":
+				usesName = true
+			case "namespace":
+			default:
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return usesName
 }
 
-func (r *PrometheusRuleReconciler) newAbsencePrometheusRule(name, namespace string, labels map[string]string) *monitoringv1.PrometheusRule {
+func newAbsencePrometheusRule(name, namespace string, labels map[string]string) *monitoringv1.PrometheusRule {
 	l := map[string]string{
 		// Add a label that identifies that this PrometheusRule resource is
 		// created and managed by this operator.
@@ -95,7 +141,13 @@ func (r *PrometheusRuleReconciler) getExistingAbsencePrometheusRule(
 
 	var absencePromRule monitoringv1.PrometheusRule
 	nsName := types.NamespacedName{Namespace: namespace, Name: name}
-	if err := r.Get(ctx, nsName, &absencePromRule); err != nil {
+	err := r.Get(ctx, nsName, &absencePromRule)
+	if apierrors.IsNotFound(err) && r.APIReader != nil && r.Scope.PrometheusRuleSelector != nil {
+		// AbsencePrometheusRules that were created before the PrometheusRuleSelector was
+		// configured might not have the labels that are required to be cached.
+		err = r.APIReader.Get(ctx, nsName, &absencePromRule)
+	}
+	if err != nil {
 		return nil, err
 	}
 	return &absencePromRule, nil
@@ -119,29 +171,99 @@ func updateAnnotationTime(absencePromRule *monitoringv1.PrometheusRule) {
 	absencePromRule.Annotations[annotationOperatorUpdatedAt] = now.UTC().Format(time.RFC3339)
 }
 
+// aggregateSourceAlerts returns a copy of the given AbsenceRuleGroups where each absence
+// alert rule has an annotation that lists the alert rules across all PrometheusRules that
+// use its metric, i.e. the combined source alerts of all absence alert rules with the
+// same name and expression. The entries have the format: promRuleName/alertName.
+//
+// This is a no-op if r.AggregateSourceAlerts is false.
+func (r *PrometheusRuleReconciler) aggregateSourceAlerts(groups []monitoringv1.RuleGroup, sources ruleGroupSources) []monitoringv1.RuleGroup {
+	if !r.AggregateSourceAlerts {
+		return groups
+	}
+
+	key := func(rule monitoringv1.Rule) string { return rule.Alert + "\x00" + rule.Expr.String() }
+	all := make(map[string][]string)
+	for _, g := range groups {
+		promRuleName := sources[g.Name].Name
+		for _, rule := range g.Rules {
+			var alerts []string
+			err := json.Unmarshal([]byte(rule.Annotations[annotationSourceAlerts]), &alerts)
+			if err != nil {
+				// Absence alert rules that were generated by an older version of the
+				// operator do not have this annotation.
+				continue
+			}
+			for _, a := range alerts {
+				all[key(rule)] = append(all[key(rule)], promRuleName+"/"+a)
+			}
+		}
+	}
+
+	result := make([]monitoringv1.RuleGroup, 0, len(groups))
+	for _, g := range groups {
+		g := *g.DeepCopy()
+		for i, rule := range g.Rules {
+			alerts, ok := all[key(rule)]
+			if !ok {
+				continue
+			}
+			buf, err := json.Marshal(slices.Compact(slices.Sorted(slices.Values(alerts))))
+			if err != nil {
+				continue
+			}
+			if g.Rules[i].Annotations == nil {
+				g.Rules[i].Annotations = make(map[string]string)
+			}
+			g.Rules[i].Annotations[annotationAllSourceAlerts] = string(buf)
+		}
+		result = append(result, g)
+	}
+	return result
+}
+
 func (r *PrometheusRuleReconciler) createAbsencePrometheusRule(ctx context.Context, absencePromRule *monitoringv1.PrometheusRule) error {
+	absencePromRule.Spec.Groups = r.aggregateSourceAlerts(absencePromRule.Spec.Groups, getRuleGroupSources(absencePromRule))
 	sortRuleGroups(absencePromRule)
 	updateAnnotationTime(absencePromRule)
-	if err := r.Create(ctx, absencePromRule); err != nil {
+	start := time.Now()
+	var err error
+	if r.DryRun {
+		err = r.recordDryRun(ctx, operationCreate, absencePromRule)
+	} else {
+		err = r.applyAbsencePrometheusRule(ctx, absencePromRule)
+	}
+	observeOperation(operationCreate, start, err)
+	if err != nil {
 		return err
 	}
+	setAbsenceRulesGauge(client.ObjectKeyFromObject(absencePromRule), countRules(absencePromRule.Spec.Groups))
+	r.recordEvent(absencePromRule, corev1.EventTypeNormal, eventReasonCreated,
+		"Created AbsencePrometheusRule with %d absence alert rules", countRules(absencePromRule.Spec.Groups))
 
 	r.Log.V(logLevelDebug).Info("successfully created AbsencePrometheusRule",
 		"AbsencePrometheusRule", fmt.Sprintf("%s/%s", absencePromRule.GetNamespace(), absencePromRule.GetName()))
 	return nil
 }
 
-func (r *PrometheusRuleReconciler) patchAbsencePrometheusRule(
-	ctx context.Context,
-	absencePromRule,
-	unmodifiedAbsencePromRule *monitoringv1.PrometheusRule,
-) error {
-
+func (r *PrometheusRuleReconciler) patchAbsencePrometheusRule(ctx context.Context, absencePromRule *monitoringv1.PrometheusRule) error {
+	absencePromRule.Spec.Groups = r.aggregateSourceAlerts(absencePromRule.Spec.Groups, getRuleGroupSources(absencePromRule))
 	sortRuleGroups(absencePromRule)
 	updateAnnotationTime(absencePromRule)
-	if err := r.Patch(ctx, absencePromRule, client.MergeFrom(unmodifiedAbsencePromRule)); err != nil {
+	start := time.Now()
+	var err error
+	if r.DryRun {
+		err = r.recordDryRun(ctx, operationPatch, absencePromRule)
+	} else {
+		err = r.applyAbsencePrometheusRule(ctx, absencePromRule)
+	}
+	observeOperation(operationPatch, start, err)
+	if err != nil {
 		return err
 	}
+	setAbsenceRulesGauge(client.ObjectKeyFromObject(absencePromRule), countRules(absencePromRule.Spec.Groups))
+	r.recordEvent(absencePromRule, corev1.EventTypeNormal, eventReasonUpdated,
+		"Updated AbsencePrometheusRule, it now has %d absence alert rules", countRules(absencePromRule.Spec.Groups))
 
 	r.Log.V(logLevelDebug).Info("successfully updated AbsencePrometheusRule",
 		"AbsencePrometheusRule", fmt.Sprintf("%s/%s", absencePromRule.GetNamespace(), absencePromRule.GetName()))
@@ -149,9 +271,20 @@ func (r *PrometheusRuleReconciler) patchAbsencePrometheusRule(
 }
 
 func (r *PrometheusRuleReconciler) deleteAbsencePrometheusRule(ctx context.Context, absencePromRule *monitoringv1.PrometheusRule) error {
-	if err := r.Delete(ctx, absencePromRule); err != nil {
+	start := time.Now()
+	var err error
+	if r.DryRun {
+		err = r.recordDryRun(ctx, operationDelete, absencePromRule)
+	} else {
+		err = r.Delete(ctx, absencePromRule)
+	}
+	observeOperation(operationDelete, start, err)
+	if err != nil {
 		return err
 	}
+	deleteAbsenceRulesGauge(client.ObjectKeyFromObject(absencePromRule))
+	r.recordEvent(absencePromRule, corev1.EventTypeNormal, eventReasonDeleted,
+		"Deleted AbsencePrometheusRule since it has no absence alert rules left")
 
 	r.Log.V(logLevelDebug).Info("successfully deleted AbsencePrometheusRule",
 		"AbsencePrometheusRule", fmt.Sprintf("%s/%s", absencePromRule.GetNamespace(), absencePromRule.GetName()))
@@ -192,9 +325,8 @@ func (r *PrometheusRuleReconciler) cleanUpOrphanedAbsenceAlertRules(
 		}
 
 		for _, aPR := range absencePromRules.Items {
-			for _, g := range aPR.Spec.Groups {
-				n := promRulefromAbsenceRuleGroupName(g.Name)
-				if n != "" && n == promRule.Name {
+			for _, src := range getRuleGroupSources(&aPR) {
+				if src.Name == promRule.Name {
 					aPRToClean = &aPR
 					break
 				}
@@ -204,14 +336,19 @@ func (r *PrometheusRuleReconciler) cleanUpOrphanedAbsenceAlertRules(
 	if aPRToClean == nil {
 		return errCorrespondingAbsencePromRuleNotExists
 	}
+	if hasManualOverride(aPRToClean) {
+		return nil
+	}
 
 	// Step 2: iterate through the AbsenceRuleGroups, skip those that were generated for
-	// this PrometheusRule and keep the rest as is.
+	// this PrometheusRule and keep the rest as is. The PrometheusRule either no longer
+	// exists or is disabled, therefore the AbsenceRuleGroups of any PrometheusRule with
+	// this name are removed, regardless of their UID.
 	oldRuleGroups := aPRToClean.Spec.Groups
+	sources := getRuleGroupSources(aPRToClean)
 	newRuleGroups := make([]monitoringv1.RuleGroup, 0, len(oldRuleGroups))
 	for _, g := range oldRuleGroups {
-		n := promRulefromAbsenceRuleGroupName(g.Name)
-		if n != "" && n == promRule.Name {
+		if sources[g.Name].Name == promRule.Name {
 			continue
 		}
 		newRuleGroups = append(newRuleGroups, g)
@@ -222,19 +359,44 @@ func (r *PrometheusRuleReconciler) cleanUpOrphanedAbsenceAlertRules(
 
 	// Step 3: if, after the cleanup, the AbsencePrometheusRule ends up being empty then
 	// delete it otherwise update.
-	if len(newRuleGroups) == 0 {
-		return r.deleteAbsencePrometheusRule(ctx, aPRToClean)
+	return r.removeOrphanedRuleGroups(ctx, aPRToClean, newRuleGroups, sources)
+}
+
+// removeOrphanedRuleGroups replaces the rule groups of the given AbsencePrometheusRule
+// with the remaining ones. If no rule groups remain then the AbsencePrometheusRule is
+// deleted.
+func (r *PrometheusRuleReconciler) removeOrphanedRuleGroups(
+	ctx context.Context,
+	absencePromRule *monitoringv1.PrometheusRule,
+	remaining []monitoringv1.RuleGroup,
+	sources ruleGroupSources,
+) error {
+
+	removed := len(absencePromRule.Spec.Groups) - len(remaining)
+	var err error
+	if len(remaining) == 0 {
+		err = r.deleteAbsencePrometheusRule(ctx, absencePromRule)
+	} else {
+		absencePromRule.Spec.Groups = remaining
+		setRuleGroupSources(absencePromRule, sources)
+		err = r.patchAbsencePrometheusRule(ctx, absencePromRule)
 	}
-	unmodified := aPRToClean.DeepCopy()
-	aPRToClean.Spec.Groups = newRuleGroups
-	return r.patchAbsencePrometheusRule(ctx, aPRToClean, unmodified)
+	if err == nil {
+		addOrphanedRuleGroups(removed)
+	}
+	return err
 }
 
 // cleanUpAbsencePrometheusRule checks an AbsencePrometheusRule to see if it contains
-// absence alert rules for a PrometheusRule that no longer exists or for a resource that
-// has the 'absent-metrics-operator/disable' label. If such rules are found then they are
-// deleted.
+// absence alert rules for a PrometheusRule that no longer exists or for a resource for
+// which the operator has been disabled, either by the 'absent-metrics-operator/disable'
+// label, by a policy, or because the resource has not opted in. If such rules are found
+// then they are deleted.
 func (r *PrometheusRuleReconciler) cleanUpAbsencePrometheusRule(ctx context.Context, absencePromRule *monitoringv1.PrometheusRule) error {
+	if hasManualOverride(absencePromRule) {
+		return nil
+	}
+
 	// Step 1: get names of all PrometheusRule resources in this namespace.
 	var listOpts client.ListOptions
 	client.InNamespace(absencePromRule.GetNamespace()).ApplyToList(&listOpts)
@@ -244,26 +406,44 @@ func (r *PrometheusRuleReconciler) cleanUpAbsencePrometheusRule(ctx context.Cont
 	}
 
 	// Step 2: collect names of those PrometheusRule resources whose absence alert rules
-	// would end up in this AbsencePrometheusRule as per the name generation template.
+	// would end up in this AbsencePrometheusRule as per the name generation template
+	// that applies to them.
+	p, err := r.listPolicies(ctx, absencePromRule.GetNamespace())
+	if err != nil {
+		return err
+	}
 	aPRName := absencePromRule.GetName()
-	prNames := make(map[string]bool)
+	prs := make(map[string]*monitoringv1.PrometheusRule)
 	for _, pr := range promRules.Items {
 		if _, ok := pr.Labels[labelOperatorManagedBy]; ok {
 			continue
 		}
-		if n, err := r.PrometheusRuleName(&pr); err == nil {
+		cfg, err := r.promRuleConfig(ctx, p, &pr)
+		if err != nil {
+			return err
+		}
+		enabled, err := r.isEnabled(ctx, cfg, &pr)
+		if err != nil {
+			return err
+		}
+		if !enabled {
+			continue
+		}
+		if n, err := cfg.prometheusRuleName.Generate(&pr); err == nil {
 			if n == aPRName {
-				prNames[pr.GetName()] = true
+				prs[pr.GetName()] = &pr
 			}
 		}
 	}
 
 	// Step 4: iterate through all the AbsencePrometheusRule's RuleGroups and remove those
-	// that don't belong to any PrometheusRule.
+	// that don't belong to any PrometheusRule. This includes AbsenceRuleGroups of an
+	// earlier PrometheusRule that has been recreated with the same name.
+	sources := getRuleGroupSources(absencePromRule)
 	newRuleGroups := make([]monitoringv1.RuleGroup, 0, len(absencePromRule.Spec.Groups))
 	for _, g := range absencePromRule.Spec.Groups {
-		n := promRulefromAbsenceRuleGroupName(g.Name)
-		if !prNames[n] {
+		src := sources[g.Name]
+		if pr, ok := prs[src.Name]; !ok || !src.isFrom(pr) {
 			continue
 		}
 		newRuleGroups = append(newRuleGroups, g)
@@ -274,46 +454,71 @@ func (r *PrometheusRuleReconciler) cleanUpAbsencePrometheusRule(ctx context.Cont
 
 	// Step 5: if, after the cleanup, the AbsencePrometheusRule ends up being empty then
 	// delete it otherwise update.
-	if len(newRuleGroups) == 0 {
-		return r.deleteAbsencePrometheusRule(ctx, absencePromRule)
-	}
-	unmodified := absencePromRule.DeepCopy()
-	absencePromRule.Spec.Groups = newRuleGroups
-	return r.patchAbsencePrometheusRule(ctx, absencePromRule, unmodified)
+	return r.removeOrphanedRuleGroups(ctx, absencePromRule, newRuleGroups, sources)
 }
 
 // updateAbsenceAlertRules generates absence alert rules for the given PrometheusRule and
 // adds them to the corresponding AbsencePrometheusRule.
-func (r *PrometheusRuleReconciler) updateAbsenceAlertRules(ctx context.Context, promRule *monitoringv1.PrometheusRule) error {
+func (r *PrometheusRuleReconciler) updateAbsenceAlertRules(
+	ctx context.Context,
+	promRule *monitoringv1.PrometheusRule,
+	cfg promRuleConfig,
+) (promRuleStatus, error) {
+
+	var status promRuleStatus
 	promRuleName := promRule.GetName()
 	namespace := promRule.GetNamespace()
 	log := r.Log.WithValues("name", promRuleName, "namespace", namespace)
 
 	// Step 1: get the corresponding AbsencePrometheusRule if it exists.
 	existingAbsencePrometheusRule := false
-	aPRName, err := r.PrometheusRuleName(promRule)
+	aPRName, err := cfg.prometheusRuleName.Generate(promRule)
 	if err != nil {
-		return err
+		// The name template can not be rendered for this PrometheusRule, e.g. because
+		// of a missing label. Retrying won't help until the PrometheusRule or the
+		// template is changed.
+		return status, &ruleGroupParseError{cause: err, reason: eventReasonNameTemplateError}
 	}
+	status.absencePromRule = aPRName
 	absencePromRule, err := r.getExistingAbsencePrometheusRule(ctx, aPRName, namespace)
 	switch {
 	case err == nil:
 		existingAbsencePrometheusRule = true
 	case apierrors.IsNotFound(err):
-		absencePromRule = r.newAbsencePrometheusRule(aPRName, namespace, promRule.GetLabels())
+		absencePromRule = newAbsencePrometheusRule(aPRName, namespace, promRule.GetLabels())
 	default:
 		// This could have been caused by a temporary network failure, or any
 		// other transient reason.
-		return err
+		return status, err
 	}
 
 	unmodifiedAbsencePromRule := absencePromRule.DeepCopy()
+	r.copyScopeLabels(absencePromRule, promRule)
 
 	// Step 2: parse RuleGroups and generate corresponding absence alert rules.
-	absenceRuleGroups, err := ParseRuleGroups(log, promRule.Spec.Groups, promRuleName, r.KeepLabel)
+	opts, err := cfg.ruleOptions.WithAnnotations(promRule.GetAnnotations())
 	if err != nil {
-		return err
+		return status, &ruleGroupParseError{cause: err}
+	}
+	opts.PrometheusRule = promRule.ObjectMeta
+	skipped := make(map[SkipReason]int)
+	opts.OnSkippedMetric = func(_, _ string, reason SkipReason) {
+		skipped[reason]++
+	}
+	unresolvedSelectors := 0
+	opts.OnUnresolvedSelector = func(alert, selector string) {
+		unresolvedSelectors++
+		r.recordEvent(promRule, corev1.EventTypeWarning, eventReasonUnresolvedSelector,
+			"Could not determine the metric name(s) for the selector %s in alert %q, no absence alert rule was generated for it",
+			selector, alert)
+	}
+	absenceRuleGroups, err := ParseRuleGroups(log, promRule.Spec.Groups, promRuleName, opts)
+	if err != nil {
+		return status, err
 	}
+	status.absenceRules = countRules(absenceRuleGroups)
+	setUnresolvedSelectorsGauge(types.NamespacedName{Namespace: namespace, Name: promRuleName}, unresolvedSelectors)
+	setSkippedMetricsGauge(types.NamespacedName{Namespace: namespace, Name: promRuleName}, skipped)
 
 	// Step 3: we clean up orphaned absence alert rules from the AbsencePrometheusRule in
 	// case no absence alert rules were generated.
@@ -322,38 +527,117 @@ func (r *PrometheusRuleReconciler) updateAbsenceAlertRules(ctx context.Context,
 	if len(absenceRuleGroups) == 0 {
 		if existingAbsencePrometheusRule {
 			key := types.NamespacedName{Namespace: namespace, Name: promRuleName}
-			return r.cleanUpOrphanedAbsenceAlertRules(ctx, key, aPRName)
+			return status, r.cleanUpOrphanedAbsenceAlertRules(ctx, key, aPRName)
 		}
-		return nil
+		return status, nil
 	}
 
 	// Step 4: if it's an existing AbsencePrometheusRule then update otherwise create a new resource.
+	// The sources of the AbsenceRuleGroups are recorded in an annotation. This also
+	// migrates AbsencePrometheusRules that were created by an older version of the
+	// operator.
 	if existingAbsencePrometheusRule {
+		if hasManualOverride(unmodifiedAbsencePromRule) {
+			log.V(logLevelDebug).Info("AbsencePrometheusRule is manually overridden, leaving it as is",
+				"AbsencePrometheusRule", aPRName)
+			return status, nil
+		}
 		existingRuleGroups := unmodifiedAbsencePromRule.Spec.Groups
-		result := mergeAbsenceRuleGroups(promRuleName, existingRuleGroups, absenceRuleGroups)
+		sources := getRuleGroupSources(unmodifiedAbsencePromRule)
+		result := mergeAbsenceRuleGroups(promRuleName, sources, existingRuleGroups, absenceRuleGroups)
+		sources.add(promRule, absenceRuleGroups)
+		absencePromRule.Spec.Groups = r.aggregateSourceAlerts(result, sources)
+		sortRuleGroups(absencePromRule)
+		setRuleGroupSources(absencePromRule, sources)
+		updateOwnerReferences(absencePromRule, promRule, cfg.prometheusRuleName.IsOneToOne())
 		if reflect.DeepEqual(unmodifiedAbsencePromRule.GetLabels(), absencePromRule.GetLabels()) &&
-			reflect.DeepEqual(existingRuleGroups, result) {
-			return nil
+			reflect.DeepEqual(unmodifiedAbsencePromRule.GetOwnerReferences(), absencePromRule.GetOwnerReferences()) &&
+			unmodifiedAbsencePromRule.Annotations[annotationRuleGroupSources] == absencePromRule.Annotations[annotationRuleGroupSources] &&
+			reflect.DeepEqual(existingRuleGroups, absencePromRule.Spec.Groups) {
+			return status, nil
 		}
-		absencePromRule.Spec.Groups = result
-		return r.patchAbsencePrometheusRule(ctx, absencePromRule, unmodifiedAbsencePromRule)
+		return status, r.patchAbsencePrometheusRule(ctx, absencePromRule)
 	}
 	absencePromRule.Spec.Groups = absenceRuleGroups
-	return r.createAbsencePrometheusRule(ctx, absencePromRule)
+	sources := make(ruleGroupSources, len(absenceRuleGroups))
+	sources.add(promRule, absenceRuleGroups)
+	setRuleGroupSources(absencePromRule, sources)
+	updateOwnerReferences(absencePromRule, promRule, cfg.prometheusRuleName.IsOneToOne())
+	return status, r.createAbsencePrometheusRule(ctx, absencePromRule)
 }
 
-// mergeAbsenceRuleGroups merges existing and newly generated AbsenceRuleGroups. If the
-// same AbsenceRuleGroup exists in both 'existing' and 'new' then the newer one will be
-// used.
-func mergeAbsenceRuleGroups(promRuleName string, existingRuleGroups, newRuleGroups []monitoringv1.RuleGroup) []monitoringv1.RuleGroup {
+// updateOwnerReferences sets the given PrometheusRule as the owner of the
+// AbsencePrometheusRule if the name template is one-to-one and the AbsencePrometheusRule
+// only holds absence alert rules for this PrometheusRule. Kubernetes' garbage collector
+// will then delete the AbsencePrometheusRule along with the PrometheusRule.
+//
+// The PrometheusRule is set as the controller of the AbsencePrometheusRule, unless another
+// object already is, and BlockOwnerDeletion is set so that a foreground deletion of the
+// PrometheusRule waits for the AbsencePrometheusRule to be deleted. The latter requires
+// the permission to update the finalizers of PrometheusRules.
+//
+// Otherwise, any existing owner references to PrometheusRules are removed. This migrates
+// AbsencePrometheusRules after the name template has been changed, e.g. from
+// '{{ .metadata.name }}' to '{{ .metadata.labels.prometheus }}'.
+func updateOwnerReferences(absencePromRule, promRule *monitoringv1.PrometheusRule, oneToOne bool) {
+	owned := oneToOne && len(absencePromRule.Spec.Groups) > 0
+	sources := getRuleGroupSources(absencePromRule)
+	for _, g := range absencePromRule.Spec.Groups {
+		if !sources[g.Name].isFrom(promRule) {
+			owned = false
+			break
+		}
+	}
+
+	var refs []metav1.OwnerReference
+	hasController := false
+	for _, ref := range absencePromRule.GetOwnerReferences() {
+		if !isPrometheusRuleOwnerReference(ref) {
+			refs = append(refs, ref)
+			hasController = hasController || ptr.Deref(ref.Controller, false)
+		}
+	}
+	if owned {
+		refs = append(refs, metav1.OwnerReference{
+			APIVersion:         monitoringv1.SchemeGroupVersion.String(),
+			Kind:               monitoringv1.PrometheusRuleKind,
+			Name:               promRule.GetName(),
+			UID:                promRule.GetUID(),
+			Controller:         ptr.To(!hasController),
+			BlockOwnerDeletion: ptr.To(true),
+		})
+	}
+	absencePromRule.SetOwnerReferences(refs)
+}
+
+func isPrometheusRuleOwnerReference(ref metav1.OwnerReference) bool {
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	return err == nil && gv.Group == monitoringv1.SchemeGroupVersion.Group && ref.Kind == monitoringv1.PrometheusRuleKind
+}
+
+// mergeAbsenceRuleGroups merges existing and newly generated AbsenceRuleGroups. The
+// existing AbsenceRuleGroups of the given PrometheusRule, as per their sources, are
+// replaced by the new ones. This deliberately only compares the names of the sources so
+// that the AbsenceRuleGroups of an earlier PrometheusRule with the same name, i.e. one
+// with a different UID, are replaced as well instead of being carried over.
+func mergeAbsenceRuleGroups(promRuleName string, sources ruleGroupSources, existingRuleGroups, newRuleGroups []monitoringv1.RuleGroup) []monitoringv1.RuleGroup {
 	var result []monitoringv1.RuleGroup
 	// Add the absence rule groups for the PrometheusRule that we are currently dealing with.
 	result = append(result, newRuleGroups...)
 	// Carry over the absence rule groups for other PrometheusRule(s) as is.
 	for _, g := range existingRuleGroups {
-		if !strings.HasPrefix(g.Name, promRuleName) {
+		if sources[g.Name].Name != promRuleName {
 			result = append(result, g)
 		}
 	}
 	return result
 }
+
+// countRules returns the total number of rules in the given RuleGroups.
+func countRules(groups []monitoringv1.RuleGroup) int {
+	n := 0
+	for _, g := range groups {
+		n += len(g.Rules)
+	}
+	return n
+}
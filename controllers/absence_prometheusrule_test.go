@@ -8,6 +8,8 @@ import (
 	. "github.com/onsi/gomega"
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
 )
 
 var _ = Describe("AbsencePrometheusRule", func() {
@@ -26,7 +28,7 @@ var _ = Describe("AbsencePrometheusRule", func() {
 		func(tmplStr, expected string, shouldFail bool) {
 			gen, err := CreateAbsencePromRuleNameGenerator(tmplStr)
 			Expect(err).ToNot(HaveOccurred())
-			actual, err := gen(pr)
+			actual, err := gen.Generate(pr)
 			if shouldFail {
 				Expect(err).To(HaveOccurred())
 				return
@@ -65,4 +67,117 @@ var _ = Describe("AbsencePrometheusRule", func() {
 			true,
 		),
 	)
+
+	DescribeTable("One-to-one name templates",
+		func(tmplStr string, expected bool) {
+			gen, err := CreateAbsencePromRuleNameGenerator(tmplStr)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gen.IsOneToOne()).To(Equal(expected))
+		},
+		Entry("original name", `{{ .metadata.name }}`, true),
+		Entry("original name with text and namespace", `foo-{{ .metadata.name }}-{{ .metadata.namespace }}`, true),
+		Entry("namespace only", `{{ .metadata.namespace }}`, false),
+		Entry("label", `{{ .metadata.labels.prometheus }}`, false),
+		Entry("original name with a function", `{{ printf "%.3s" .metadata.name }}`, false),
+		Entry("original name within a condition", `{{ if .metadata.labels.prometheus }}{{ .metadata.name }}{{ end }}`, false),
+		Entry("default template", DefaultAbsencePromRuleNameTemplate, false),
+	)
+
+	It("sets owner references in one-to-one mode", func() {
+		owner := pr.DeepCopy()
+		owner.UID = "8a4c2f5e-6f2a-4b8e-9d6c-3b1f0e7a9c21"
+		otherRef := metav1.OwnerReference{APIVersion: "v1", Kind: "ConfigMap", Name: "foo", UID: "0d9e3b7a-1c4f-4e2b-8a6d-5f2c9b1e7d43"}
+		aPR := &monitoringv1.PrometheusRule{
+			ObjectMeta: metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{otherRef}},
+			Spec: monitoringv1.PrometheusRuleSpec{
+				Groups: []monitoringv1.RuleGroup{{Name: "foobar.alerts/foo"}, {Name: "foobar.alerts/bar"}},
+			},
+		}
+		ownerRef := metav1.OwnerReference{
+			APIVersion:         "monitoring.coreos.com/v1",
+			Kind:               "PrometheusRule",
+			Name:               "foobar.alerts",
+			UID:                owner.UID,
+			Controller:         ptr.To(true),
+			BlockOwnerDeletion: ptr.To(true),
+		}
+
+		updateOwnerReferences(aPR, owner, true)
+		Expect(aPR.OwnerReferences).To(Equal([]metav1.OwnerReference{otherRef, ownerRef}))
+		// Idempotent.
+		updateOwnerReferences(aPR, owner, true)
+		Expect(aPR.OwnerReferences).To(Equal([]metav1.OwnerReference{otherRef, ownerRef}))
+
+		// The owner reference is removed once the name template is no longer one-to-one...
+		updateOwnerReferences(aPR, owner, false)
+		Expect(aPR.OwnerReferences).To(Equal([]metav1.OwnerReference{otherRef}))
+
+		// ...or if the AbsencePrometheusRule holds absence alert rules for other PrometheusRules.
+		updateOwnerReferences(aPR, owner, true)
+		aPR.Spec.Groups = append(aPR.Spec.Groups, monitoringv1.RuleGroup{Name: "other.alerts/foo"})
+		updateOwnerReferences(aPR, owner, true)
+		Expect(aPR.OwnerReferences).To(Equal([]metav1.OwnerReference{otherRef}))
+
+		// ...or if the AbsencePrometheusRule holds absence alert rules for an earlier
+		// PrometheusRule with the same name.
+		aPR.Spec.Groups = aPR.Spec.Groups[:2]
+		setRuleGroupSources(aPR, ruleGroupSources{
+			"foobar.alerts/foo": {Name: "foobar.alerts", UID: owner.UID},
+			"foobar.alerts/bar": {Name: "foobar.alerts", UID: "3f6b1d2c-9e4a-4c7b-8f1e-2a5d6c7b8e90"},
+		})
+		updateOwnerReferences(aPR, owner, true)
+		Expect(aPR.OwnerReferences).To(Equal([]metav1.OwnerReference{otherRef}))
+		delete(aPR.Annotations, annotationRuleGroupSources)
+
+		// The PrometheusRule is not set as the controller if another object already is.
+		aPR.Spec.Groups = aPR.Spec.Groups[:2]
+		aPR.OwnerReferences[0].Controller = ptr.To(true)
+		updateOwnerReferences(aPR, owner, true)
+		Expect(aPR.OwnerReferences).To(HaveLen(2))
+		Expect(aPR.OwnerReferences[1].Controller).To(Equal(ptr.To(false)))
+	})
+
+	It("aggregates source alerts across all PrometheusRules", func() {
+		rule := func(alert, expr, sourceAlerts string) monitoringv1.Rule {
+			return monitoringv1.Rule{
+				Alert:       alert,
+				Expr:        intstr.FromString(expr),
+				Annotations: map[string]string{"source_alerts": sourceAlerts},
+			}
+		}
+		groups := []monitoringv1.RuleGroup{
+			{
+				Name: "foo.alerts/foo",
+				Rules: []monitoringv1.Rule{
+					rule("AbsentFoo", "absent(foo)", `["FooHigh","FooLow"]`),
+					rule("AbsentBar", "absent(bar)", `["Bar"]`),
+				},
+			},
+			{
+				Name:  "bar.alerts/bar",
+				Rules: []monitoringv1.Rule{rule("AbsentFoo", "absent(foo)", `["FooHigh"]`)},
+			},
+		}
+
+		sources := ruleGroupSources{
+			"foo.alerts/foo": {Name: "foo.alerts"},
+			"bar.alerts/bar": {Name: "bar.alerts"},
+		}
+
+		r := &PrometheusRuleReconciler{}
+		Expect(r.aggregateSourceAlerts(groups, sources)).To(Equal(groups))
+
+		r.AggregateSourceAlerts = true
+		actual := r.aggregateSourceAlerts(groups, sources)
+		Expect(actual).To(HaveLen(2))
+		Expect(actual[0].Rules[0].Annotations).To(HaveKeyWithValue("all_source_alerts",
+			`["bar.alerts/FooHigh","foo.alerts/FooHigh","foo.alerts/FooLow"]`))
+		Expect(actual[0].Rules[1].Annotations).To(HaveKeyWithValue("all_source_alerts",
+			`["foo.alerts/Bar"]`))
+		Expect(actual[1].Rules[0].Annotations).To(HaveKeyWithValue("all_source_alerts",
+			`["bar.alerts/FooHigh","foo.alerts/FooHigh","foo.alerts/FooLow"]`))
+
+		// The given groups must not be modified.
+		Expect(groups[0].Rules[0].Annotations).ToNot(HaveKey("all_source_alerts"))
+	})
 })
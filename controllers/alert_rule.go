@@ -4,19 +4,42 @@
 package controllers
 
 import (
-	"errors"
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
 
 	"github.com/go-logr/logr"
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/prometheus/common/model"
 	promlabels "github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/promql/parser"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
-	"k8s.io/apimachinery/pkg/util/intstr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SkipReason is the reason why no absence alert rule is generated for a metric.
+type SkipReason string
+
+// These are the valid values for SkipReason.
+const (
+	// SkipReasonGuarded is used if the expression already checks the absence of the
+	// metric, e.g. foo > 0 or absent(foo).
+	SkipReasonGuarded SkipReason = "guarded"
+	// SkipReasonUp is used for the "up" metric.
+	SkipReasonUp SkipReason = "up"
+	// SkipReasonFiltered is used if the metric is excluded by the metric name filter.
+	SkipReasonFiltered SkipReason = "filtered"
+	// SkipReasonNoAlertOnAbsence is used if the alert rule has the
+	// 'no_alert_on_absence' label.
+	SkipReasonNoAlertOnAbsence SkipReason = "no_alert_on_absence"
+	// SkipReasonUnresolved is used if no metric name could be determined for a
+	// VectorSelector.
+	SkipReasonUnresolved SkipReason = "unresolved"
 )
 
 // metricNameExtractor is used to walk through a PromQL expression and extract
@@ -27,11 +50,37 @@ type metricNameExtractor struct {
 	// expr is the PromQL expression that the metricNameExtractor is working on.
 	expr string
 
-	// This map contains metric names that were extracted from a promql.Node.
-	// We only use the keys of the map and never depend on the presence of an
-	// element in the map nor its value therefore we use an empty struct instead
-	// of a bool.
-	found map[string]struct{}
+	// keepLabelMatchers specifies whether the equality label matchers of a
+	// VectorSelector should be retained for the metric.
+	keepLabelMatchers bool
+
+	// filter decides which metric names are considered.
+	filter *MetricNameFilter
+
+	// This map contains the selectors that were extracted from a promql.Node. It is
+	// keyed by the string representation of the selector so that the same metric used
+	// with the same (retained) label matchers is only recorded once. If
+	// keepLabelMatchers is false then the selectors only consist of the metric name.
+	found map[string]selector
+
+	// unresolved contains the VectorSelector(s) for which a metric name could not be
+	// determined, e.g. {__name__=~"foo_.*"}.
+	unresolved []string
+	// skipped contains the metric names that were skipped together with the reason.
+	skipped []skippedMetric
+
+	// guards contains the VectorSelector(s) that are used as arguments for the absent()
+	// and absent_over_time() functions in the expression.
+	guards map[*parser.VectorSelector]bool
+	// guarded contains the normalized selectors (see newSelector) of the selectors in
+	// guards, keyed by their string representation.
+	guarded map[string]bool
+}
+
+// skippedMetric is a metric for which no absence alert rule is generated.
+type skippedMetric struct {
+	name   string
+	reason SkipReason
 }
 
 // Visit implements the parser.Visitor interface.
@@ -40,60 +89,293 @@ func (mex *metricNameExtractor) Visit(node parser.Node, path []parser.Node) (par
 	if !ok {
 		return mex, nil
 	}
+	if mex.guards[vs] {
+		// This is the argument of an absent() function in the original expression.
+		return mex, nil
+	}
+
+	names := metricNames(vs)
+	if len(names) == 0 {
+		mex.logger.V(logLevelDebug).Info("could not find metric name for VectorSelector",
+			"selector", vs.String(), "expr", mex.expr)
+		mex.unresolved = append(mex.unresolved, vs.String())
+		return mex, nil
+	}
+
+	for _, name := range names {
+		switch {
+		case mex.guarded[mex.newSelector(name, vs.LabelMatchers).String()]:
+			// Skip this metric if the there is already an absent function for the same
+			// selector in the original expression.
+			// E.g. absent(metric_name) or absent_over_time(metric_name[5m])
+			mex.skipped = append(mex.skipped, skippedMetric{name, SkipReasonGuarded})
+		case name == "up":
+			// Skip "up" metric, it is automatically injected by Prometheus to describe
+			// Prometheus scraping jobs.
+			mex.skipped = append(mex.skipped, skippedMetric{name, SkipReasonUp})
+		case !mex.filter.Allows(name):
+			// Skip metrics that are excluded by the cluster-wide metric name filter.
+			mex.skipped = append(mex.skipped, skippedMetric{name, SkipReasonFiltered})
+		default:
+			mex.addFound(name, vs.LabelMatchers)
+		}
+	}
+	return mex, nil
+}
 
-	name := vs.Name
-	if name == "" {
-		// Check if the VectorSelector uses label matching against the internal `__name__`
-		// label. For example, the expression `http_requests_total` is equivalent to
-		// `{__name__="http_requests_total"}`.
-		for _, v := range vs.LabelMatchers {
-			if v.Name != "__name__" {
-				continue
+// collectGuards records the selectors that are already checked for absence in the
+// given expression, i.e. the selectors that are used as arguments for the absent() and
+// absent_over_time() functions.
+//
+// This needs to be done before walking through the expression since the absent()
+// function could come after the usage of a metric, e.g. foo > 0 or absent(foo).
+func (mex *metricNameExtractor) collectGuards(node parser.Node) {
+	parser.Inspect(node, func(n parser.Node, _ []parser.Node) error {
+		call, ok := n.(*parser.Call)
+		if !ok || (call.Func.Name != "absent" && call.Func.Name != "absent_over_time") || len(call.Args) != 1 {
+			return nil
+		}
+
+		arg := call.Args[0]
+		for {
+			paren, ok := arg.(*parser.ParenExpr)
+			if !ok {
+				break
 			}
+			arg = paren.Expr
+		}
+		if ms, ok := arg.(*parser.MatrixSelector); ok {
+			arg = ms.VectorSelector
+		}
+		vs, ok := arg.(*parser.VectorSelector)
+		if !ok {
+			return nil
+		}
 
-			switch v.Type {
-			case promlabels.MatchEqual, promlabels.MatchNotEqual:
-				name = v.Value
-			case promlabels.MatchRegexp, promlabels.MatchNotRegexp:
-				// Currently, we don't create absence alerts for regex name
-				// label matching.
-				// However, there are cases where some alert expressions use
-				// regexp matching even where an equality would suffice.
-				// E.g.:
-				//   {__name__=~"http_requests_total"}
-				rx, err := regexp.Compile(v.Value)
-				if err != nil {
-					// We do not return on error here so that any subsequent
-					// VectorSelector(s) get a chance to be processed.
-					mex.logger.Error(err, "could not compile regex: "+v.Value, "expr", mex.expr)
-					continue
-				}
-				if rx.MatchString(v.Value) {
-					name = v.Value
-				}
+		mex.guards[vs] = true
+		for _, name := range metricNames(vs) {
+			mex.guarded[mex.newSelector(name, vs.LabelMatchers).String()] = true
+		}
+		return nil
+	})
+}
+
+// metricNames returns the metric names that a VectorSelector can match. It returns nil
+// if the metric names can not be determined.
+func metricNames(vs *parser.VectorSelector) []string {
+	if vs.Name != "" {
+		return []string{vs.Name}
+	}
+
+	// Check if the VectorSelector uses label matching against the internal `__name__`
+	// label. For example, the expression `http_requests_total` is equivalent to
+	// `{__name__="http_requests_total"}`.
+	var names []string
+	for _, v := range vs.LabelMatchers {
+		if v.Name != promlabels.MetricName {
+			continue
+		}
+
+		switch v.Type {
+		case promlabels.MatchEqual, promlabels.MatchNotEqual:
+			names = []string{v.Value}
+		case promlabels.MatchRegexp:
+			// Regex name label matching is only supported if the regex is a finite
+			// alternation of literals, in which case an absence alert rule is
+			// generated for each alternative. E.g.:
+			//   {__name__=~"http_requests_total"}
+			//   {__name__=~"foo_total|bar_total"}
+			// The matcher has already been compiled by the parser so the error can
+			// be ignored.
+			rx, err := promlabels.NewFastRegexMatcher(v.Value)
+			if err == nil {
+				names = rx.SetMatches()
 			}
+		case promlabels.MatchNotRegexp:
+			// A negative regex matcher can match an unbounded set of metric names.
 		}
 	}
-	if name == "" {
-		mex.logger.Error(errors.New("error while parsing PromQL query"),
-			"could not find metric name for VectorSelector: "+vs.String(),
-			"expr", mex.expr)
-		return mex, nil
+	return names
+}
+
+// newSelector returns the selector that an absence alert rule would use for the given
+// metric name and label matchers. It is also used to match selectors against the
+// arguments of absent() functions so that a metric is considered guarded exactly when
+// the absence expression that would be generated for it is already present.
+func (mex *metricNameExtractor) newSelector(name string, matchers []*promlabels.Matcher) selector {
+	sel := selector{name: name}
+	if mex.keepLabelMatchers {
+		for _, m := range matchers {
+			if keepLabelMatcher(m) {
+				sel.matchers = append(sel.matchers, m)
+			}
+		}
+		sort.Slice(sel.matchers, func(i, j int) bool {
+			if sel.matchers[i].Name == sel.matchers[j].Name {
+				return sel.matchers[i].Value < sel.matchers[j].Value
+			}
+			return sel.matchers[i].Name < sel.matchers[j].Name
+		})
 	}
+	return sel
+}
 
-	switch {
-	case strings.Contains(mex.expr, "absent("+name) ||
-		strings.Contains(mex.expr, fmt.Sprintf("absent({__name__=\"%s\"", name)):
-		// Skip this metric if the there is already an absent function for it in the
-		// original expression.
-		// E.g. absent(metric_name) || absent({__name__="metric_name"})
-	case name == "up":
-		// Skip "up" metric, it is automatically injected by Prometheus to describe
-		// Prometheus scraping jobs.
-	default:
-		mex.found[name] = struct{}{}
+// addFound records the selector identity for the given metric name and label matchers.
+func (mex *metricNameExtractor) addFound(name string, matchers []*promlabels.Matcher) {
+	sel := mex.newSelector(name, matchers)
+	mex.found[sel.String()] = sel
+}
+
+// keepLabelMatcher returns true if the given label matcher can be carried over to an
+// absence alert rule expression.
+//
+// Only equality matchers are retained. Regex matchers (=~, !~) and negative matchers (!=)
+// are dropped since the absence of a time series can not be reliably determined for
+// them. Matchers whose values use templating (i.e. contain '$' or '{{') are dropped as
+// well since they are not resolved in an absence alert rule.
+func keepLabelMatcher(m *promlabels.Matcher) bool {
+	if m.Name == promlabels.MetricName || m.Type != promlabels.MatchEqual {
+		return false
 	}
-	return mex, nil
+	return !strings.Contains(m.Value, "$") && !strings.Contains(m.Value, "{{")
+}
+
+// selector identifies a time series for which an absence alert rule is generated. It
+// consists of the metric name and the normalized (i.e. retained and sorted) equality
+// label matchers.
+type selector struct {
+	name     string
+	matchers []*promlabels.Matcher
+}
+
+// String returns the PromQL representation of the selector, e.g.
+// metric_name{label="value"}. Two selectors are the same if their string
+// representations are equal.
+func (s selector) String() string {
+	vs := &parser.VectorSelector{Name: s.name, LabelMatchers: s.matchers}
+	return vs.String()
+}
+
+// absenceExpr returns the expression for an absence alert rule for the given selector.
+func absenceExpr(sel selector, opts RuleOptions) string {
+	if opts.AbsenceMode == AbsenceModeOverTime {
+		rng := opts.AbsenceRange
+		if rng == "" {
+			rng = DefaultAbsenceRange
+		}
+		return fmt.Sprintf("absent_over_time(%s[%s])", sel, rng)
+	}
+	return fmt.Sprintf("absent(%s)", sel)
+}
+
+// absenceRule holds everything that is needed to render an absence alert rule.
+//
+// The absence alert rules that are generated for different alert rules which use the
+// same metric are merged before they are rendered.
+type absenceRule struct {
+	alert    string
+	sel      selector
+	expr     string
+	rng      monitoringv1.Duration
+	duration monitoringv1.Duration
+	// labels are the labels that were retained from the original alert rule.
+	labels map[string]string
+
+	sourceAlert string
+	// sourceAlerts are the names of all alert rules that use the metric.
+	sourceAlerts []string
+	// severity is the severity of the absence alert rule. sourceSeverity is the
+	// severity of the original alert rule that it was mapped from, if any.
+	severity       string
+	sourceSeverity string
+	// severityRank is the priority of the sourceSeverity in the SeverityMap. Lower
+	// values have higher priority.
+	severityRank int
+
+	template *AbsenceRuleTemplate
+	metadata metav1.ObjectMeta
+}
+
+// key returns the identity of an absence alert rule. Absence alert rules with the same
+// key are merged.
+func (r absenceRule) key() string {
+	labels := make([]string, 0, len(r.labels))
+	for k, v := range r.labels {
+		labels = append(labels, k+"="+v)
+	}
+	sort.Strings(labels)
+	return r.alert + "\x00" + r.expr + "\x00" + strings.Join(labels, ",")
+}
+
+// setSeverity determines the severity of the absence alert rule from the severity of
+// the original alert rule using the given SeverityMap.
+func (r *absenceRule) setSeverity(sourceSeverity string, m SeverityMap) {
+	r.severity = DefaultAbsenceSeverity
+	r.sourceSeverity = ""
+	r.severityRank = len(m)
+	if target, rank, ok := m.lookup(sourceSeverity); ok {
+		r.severity = target
+		r.sourceSeverity = sourceSeverity
+		r.severityRank = rank
+	}
+}
+
+// merge merges another absence alert rule with the same key into this one. The
+// largest 'for' duration and the severity with the highest priority are used.
+func (r *absenceRule) merge(other absenceRule) {
+	r.sourceAlerts = append(slices.Clip(r.sourceAlerts), other.sourceAlerts...)
+	if parseDurationOrZero(other.duration) > parseDurationOrZero(r.duration) {
+		r.duration = other.duration
+	}
+	if other.severityRank < r.severityRank {
+		r.severity = other.severity
+		r.sourceSeverity = other.sourceSeverity
+		r.severityRank = other.severityRank
+	}
+}
+
+// render renders the absence alert rule using its template.
+func (r absenceRule) render() (monitoringv1.Rule, error) {
+	sourceAlerts := slices.Compact(slices.Sorted(slices.Values(r.sourceAlerts)))
+	rule, err := r.template.render(map[string]any{
+		"alert":          r.alert,
+		"sourceAlert":    r.sourceAlert,
+		"sourceAlerts":   sourceAlerts,
+		"metric":         r.sel.name,
+		"selector":       r.sel.String(),
+		"expr":           r.expr,
+		"range":          r.rng,
+		"for":            r.duration,
+		"severity":       r.severity,
+		"sourceSeverity": r.sourceSeverity,
+		"labels":         r.labels,
+		"metadata":       promRuleMetadata(r.metadata),
+	})
+	if err != nil {
+		return rule, fmt.Errorf("could not generate absence alert rule for alert rule %s: %w", r.sourceAlert, err)
+	}
+
+	if rule.Annotations == nil {
+		rule.Annotations = make(map[string]string)
+	}
+	buf, err := json.Marshal(sourceAlerts)
+	if err != nil {
+		return rule, err
+	}
+	rule.Annotations[annotationSourceAlerts] = string(buf)
+	if r.sourceSeverity != "" {
+		rule.Annotations[annotationSourceSeverity] = r.sourceSeverity
+	}
+	return rule, nil
+}
+
+// parseDurationOrZero parses a duration. Invalid durations are treated as zero.
+func parseDurationOrZero(d monitoringv1.Duration) model.Duration {
+	v, err := model.ParseDuration(string(d))
+	if err != nil {
+		return 0
+	}
+	return v
 }
 
 // AbsenceRuleGroupName returns the name of the RuleGroup that holds absence alert rules
@@ -105,56 +387,119 @@ func AbsenceRuleGroupName(promRule, ruleGroup string) string {
 // promRulefromAbsenceRuleGroupName takes the name of a RuleGroup that holds absence alert
 // rules and returns the name of the corresponding PrometheusRule that holds the actual
 // alert definitions. An empty string is returned if the name can't be determined.
+//
+// This is only used for AbsencePrometheusRules that don't record the sources of their
+// RuleGroups yet, see getRuleGroupSources.
 func promRulefromAbsenceRuleGroupName(ruleGroup string) string {
-	sL := strings.Split(ruleGroup, "/")
-	if len(sL) != 2 {
+	// The name of a PrometheusRule can not contain a slash but the name of the RuleGroup
+	// can.
+	promRule, _, ok := strings.Cut(ruleGroup, "/")
+	if !ok {
 		return ""
 	}
-	return sL[0]
+	return promRule
 }
 
 type ruleGroupParseError struct {
 	cause error
+	// group and rule optionally identify the offending RuleGroup and alert rule.
+	group string
+	rule  string
+	// reason is the reason of the Warning event that is emitted for this error.
+	// eventReasonParseError is used if empty.
+	reason string
+}
+
+// eventReason returns the reason of the Warning event that is emitted for this error.
+func (e *ruleGroupParseError) eventReason() string {
+	if e.reason == "" {
+		return eventReasonParseError
+	}
+	return e.reason
 }
 
 // Error implements the error interface.
 func (e *ruleGroupParseError) Error() string {
-	return e.cause.Error()
+	switch {
+	case e.group == "":
+		return e.cause.Error()
+	case e.rule == "":
+		return fmt.Sprintf("rule group %q: %s", e.group, e.cause.Error())
+	default:
+		return fmt.Sprintf("rule group %q, alert rule %q: %s", e.group, e.rule, e.cause.Error())
+	}
 }
 
 // ParseRuleGroups takes a slice of RuleGroup that has alert rules and returns
 // a new slice of RuleGroup that has the corresponding absence alert rules.
 //
-// The labels specified in the keepLabel map will be carried over to the corresponding
-// absence alerts unless templating (i.e. $labels) was used for these labels.
+// The labels specified in the opts.KeepLabel map will be carried over to the
+// corresponding absence alerts unless templating (i.e. $labels) was used for these
+// labels.
+//
+// If multiple alert rules use the same metric then the corresponding absence alert
+// rules are merged, see absenceRule.merge().
 //
 // The rule group names for the absence alerts have the format: promRuleName/originalGroupName.
-func ParseRuleGroups(logger logr.Logger, in []monitoringv1.RuleGroup, promRuleName string, keepLabel KeepLabel) ([]monitoringv1.RuleGroup, error) {
-	out := make([]monitoringv1.RuleGroup, 0, len(in))
+func ParseRuleGroups(logger logr.Logger, in []monitoringv1.RuleGroup, promRuleName string, opts RuleOptions) ([]monitoringv1.RuleGroup, error) {
+	// Step 1: collect absence alert rules for each RuleGroup and merge the ones that
+	// are generated for the same metric across the entire PrometheusRule.
+	type group struct {
+		name  string
+		rules []absenceRule
+	}
+	groups := make([]group, 0, len(in))
+	merged := make(map[string]*absenceRule)
 	for _, g := range in {
-		var absenceAlertRules []monitoringv1.Rule
+		var rules []absenceRule
+		seen := make(map[string]bool)
 		for _, r := range g.Rules {
-			rules, err := parseRule(logger, r, keepLabel)
+			ar, err := collectAbsenceRules(logger, r, opts)
 			if err != nil {
-				return nil, &ruleGroupParseError{cause: err}
+				return nil, &ruleGroupParseError{cause: err, group: g.Name, rule: r.Alert}
 			}
-			if len(rules) > 0 {
-				absenceAlertRules = append(absenceAlertRules, rules...)
+			for _, v := range ar {
+				key := v.key()
+				if m, ok := merged[key]; ok {
+					m.merge(v)
+				} else {
+					merged[key] = &v
+				}
+				// Only keep the first absence alert rule for a metric in a RuleGroup.
+				if !seen[key] {
+					seen[key] = true
+					rules = append(rules, v)
+				}
 			}
 		}
+		if len(rules) > 0 {
+			groups = append(groups, group{name: g.Name, rules: rules})
+		}
+	}
 
-		if len(absenceAlertRules) > 0 {
-			// Sort alert rules for consistent test results.
-			sort.SliceStable(absenceAlertRules, func(i, j int) bool {
-				return absenceAlertRules[i].Alert < absenceAlertRules[j].Alert
-			})
-
-			out = append(out, monitoringv1.RuleGroup{
-				Name:  AbsenceRuleGroupName(promRuleName, g.Name),
-				Rules: absenceAlertRules,
-			})
+	// Step 2: render the merged absence alert rules.
+	out := make([]monitoringv1.RuleGroup, 0, len(groups))
+	for _, g := range groups {
+		rules := make([]monitoringv1.Rule, 0, len(g.rules))
+		for _, v := range g.rules {
+			m := *merged[v.key()]
+			// The annotations of an absence alert rule refer to the first alert rule in
+			// its own RuleGroup.
+			m.sourceAlert = v.sourceAlert
+			rule, err := m.render()
+			if err != nil {
+				return nil, &ruleGroupParseError{cause: err, group: g.name, rule: v.sourceAlert}
+			}
+			rules = append(rules, rule)
 		}
+		sortRules(rules)
+		out = append(out, monitoringv1.RuleGroup{
+			Name:  AbsenceRuleGroupName(promRuleName, g.name),
+			Rules: rules,
+		})
 	}
+
+	disambiguateAlertNames(out)
 	return out, nil
 }
 
@@ -164,24 +509,56 @@ var nonAlphaNumericRx = regexp.MustCompile(`[^a-zA-Z0-9]`)
 // Since an alert expression can reference multiple time series therefore a slice of
 // []monitoringv1.Rule is returned as multiple absence alert rules would be generated —
 // one for each time series.
-func parseRule(logger logr.Logger, in monitoringv1.Rule, keepLabel KeepLabel) ([]monitoringv1.Rule, error) {
+func parseRule(logger logr.Logger, in monitoringv1.Rule, opts RuleOptions) ([]monitoringv1.Rule, error) {
+	ar, err := collectAbsenceRules(logger, in, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]monitoringv1.Rule, 0, len(ar))
+	for _, v := range ar {
+		rule, err := v.render()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rule)
+	}
+	return out, nil
+}
+
+// collectAbsenceRules determines the absence alert rules for a given Rule. The
+// returned absence alert rules are sorted by name and expression.
+func collectAbsenceRules(logger logr.Logger, in monitoringv1.Rule, opts RuleOptions) ([]absenceRule, error) {
 	// Do not parse recording rules.
 	if in.Record != "" {
 		return nil, nil
 	}
 	// Do not parse alert rule if it has the no_alert_on_absence label.
 	if in.Labels != nil && parseBool(in.Labels[labelNoAlertOnAbsence]) {
+		if opts.OnSkippedMetric != nil {
+			opts.OnSkippedMetric(in.Alert, "", SkipReasonNoAlertOnAbsence)
+		}
 		return nil, nil
 	}
+	// Options can be overridden for a specific alert rule.
+	opts, err := opts.WithAnnotations(in.Annotations)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse options for alert rule %s: %w", in.Alert, err)
+	}
 
 	exprStr := in.Expr.String()
 	mex := &metricNameExtractor{
-		logger: logger,
-		expr:   exprStr,
-		found:  map[string]struct{}{},
+		logger:            logger,
+		expr:              exprStr,
+		keepLabelMatchers: opts.KeepLabelMatchers,
+		filter:            opts.MetricNameFilter,
+		found:             make(map[string]selector),
+		guards:            make(map[*parser.VectorSelector]bool),
+		guarded:           make(map[string]bool),
 	}
 	exprNode, err := parser.ParseExpr(exprStr)
 	if err == nil {
+		mex.collectGuards(exprNode)
 		err = parser.Walk(mex, exprNode, nil)
 	}
 	if err != nil {
@@ -190,83 +567,151 @@ func parseRule(logger logr.Logger, in monitoringv1.Rule, keepLabel KeepLabel) ([
 		// it could contain newline characters.
 		return nil, fmt.Errorf("could not parse rule expression: %s: %s", err.Error(), exprStr)
 	}
+	if opts.OnUnresolvedSelector != nil {
+		for _, v := range mex.unresolved {
+			opts.OnUnresolvedSelector(in.Alert, v)
+		}
+	}
+	if opts.OnSkippedMetric != nil {
+		for _, v := range mex.skipped {
+			opts.OnSkippedMetric(in.Alert, v.name, v.reason)
+		}
+		for _, v := range mex.unresolved {
+			opts.OnSkippedMetric(in.Alert, v, SkipReasonUnresolved)
+		}
+	}
 	if len(mex.found) == 0 {
 		return nil, nil
 	}
 
-	// Default labels.
-	absenceRuleLabels := map[string]string{
-		"context":  "absent-metrics",
-		"severity": "info",
+	duration, err := opts.absenceFor(in.For)
+	if err != nil {
+		return nil, fmt.Errorf("could not determine 'for' duration for alert rule %s: %w", in.Alert, err)
 	}
 
 	// Retain labels from the original alert rule.
+	keptLabels := make(map[string]string)
 	if ruleLabels := in.Labels; ruleLabels != nil {
-		for k := range keepLabel {
+		for k := range opts.KeepLabel {
 			v := ruleLabels[k]
 			if v != "" && !strings.Contains(v, "$labels") {
-				absenceRuleLabels[k] = v
+				keptLabels[k] = v
 			}
 		}
 	}
 
-	out := make([]monitoringv1.Rule, 0, len(mex.found))
-	for m := range mex.found {
-		// Generate an alert name from metric name. Example:
-		//   network:tis_a_metric:rate5m -> Absent(Support Group|Tier)ServiceNetworkTisAMetricRate5m
-		supportGroup := absenceRuleLabels[LabelSupportGroup]
-		if supportGroup == "" {
-			supportGroup = absenceRuleLabels[LabelTier] // use tier in case there is no support group
+	tmpl := opts.Template
+	if tmpl == nil {
+		tmpl = defaultAbsenceRuleTemplate
+	}
+	rng := opts.AbsenceRange
+	if rng == "" {
+		rng = DefaultAbsenceRange
+	}
+
+	out := make([]absenceRule, 0, len(mex.found))
+	for _, sel := range mex.found {
+		r := absenceRule{
+			alert:        absenceAlertName(sel, keptLabels),
+			sel:          sel,
+			expr:         absenceExpr(sel, opts),
+			rng:          rng,
+			duration:     duration,
+			labels:       keptLabels,
+			sourceAlert:  in.Alert,
+			sourceAlerts: []string{in.Alert},
+			template:     tmpl,
+			metadata:     opts.PrometheusRule,
 		}
-		var words []string
-		for _, v := range []string{"absent", supportGroup, absenceRuleLabels[LabelService], m} {
-			s := nonAlphaNumericRx.Split(v, -1) // remove non-alphanumeric characters
-			words = append(words, s...)
+		r.setSeverity(in.Labels[labelSeverity], opts.SeverityMap)
+		out = append(out, r)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].alert == out[j].alert {
+			return out[i].expr < out[j].expr
 		}
-		// Avoid name stuttering
-		//
-		// TODO: fix edge case when support_group or service label value has non-numeric
-		// character and splitting it will still result in name stuttering because
-		// matching with previous word (as we do below) does not work as the original word
-		// has been split into multiple words.
-		// Example: support_group = "containers", service = "go-pmtud",
-		// and metric = "go_pmtud_sent_error_peer_total" will result in
-		// "AbsentContainersGoPmtudGoPmtudSentErrorPeerTotal" as the alert name.
-		var alertName string
-		var prevW string
-		for _, v := range words {
-			w := strings.ToLower(v) // convert to lowercase for comparison
-			if w != prevW {
-				alertName += cases.Title(language.English).String(w)
-				prevW = w
-			}
+		return out[i].alert < out[j].alert
+	})
+	return out, nil
+}
+
+// absenceAlertName generates an alert name from the metric name and the retained label
+// matchers of a selector. Example:
+//
+//	network:tis_a_metric:rate5m -> Absent(Support Group|Tier)ServiceNetworkTisAMetricRate5m
+//	up_foo{region="a"}          -> Absent(Support Group|Tier)ServiceUpFooRegionA
+func absenceAlertName(sel selector, labels map[string]string) string {
+	supportGroup := labels[LabelSupportGroup]
+	if supportGroup == "" {
+		supportGroup = labels[LabelTier] // use tier in case there is no support group
+	}
+	nameParts := []string{"absent", supportGroup, labels[LabelService], sel.name}
+	for _, m := range sel.matchers {
+		nameParts = append(nameParts, m.Name, m.Value)
+	}
+	var words []string
+	for _, v := range nameParts {
+		s := nonAlphaNumericRx.Split(v, -1) // remove non-alphanumeric characters
+		words = append(words, s...)
+	}
+	// Avoid name stuttering
+	//
+	// TODO: fix edge case when support_group or service label value has non-numeric
+	// character and splitting it will still result in name stuttering because
+	// matching with previous word (as we do below) does not work as the original word
+	// has been split into multiple words.
+	// Example: support_group = "containers", service = "go-pmtud",
+	// and metric = "go_pmtud_sent_error_peer_total" will result in
+	// "AbsentContainersGoPmtudGoPmtudSentErrorPeerTotal" as the alert name.
+	var alertName string
+	var prevW string
+	for _, v := range words {
+		w := strings.ToLower(v) // convert to lowercase for comparison
+		if w != prevW {
+			alertName += cases.Title(language.English).String(w)
+			prevW = w
 		}
+	}
+	return alertName
+}
 
-		// TODO: remove the link from description and add a 'playbook' label,
-		// when our upstream solution gets the ability to process hardcoded
-		// links in the 'playbook' label.
-		ann := map[string]string{
-			"summary": "missing " + m,
-			"description": fmt.Sprintf(
-				"The metric '%s' is missing. '%s' alert using it may not fire as intended. "+
-					"See <https://github.com/sapcc/absent-metrics-operator/blob/master/docs/playbook.md|the operator playbook>.",
-				m, in.Alert,
-			),
+// sortRules sorts alert rules by name and expression for consistent test results.
+func sortRules(rules []monitoringv1.Rule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Alert == rules[j].Alert {
+			return rules[i].Expr.String() < rules[j].Expr.String()
 		}
+		return rules[i].Alert < rules[j].Alert
+	})
+}
 
-		duration := monitoringv1.Duration("10m")
-		out = append(out, monitoringv1.Rule{
-			Alert:       alertName,
-			Expr:        intstr.FromString(fmt.Sprintf("absent(%s)", m)),
-			For:         &duration,
-			Labels:      absenceRuleLabels,
-			Annotations: ann,
-		})
+// disambiguateAlertNames ensures that absence alert rules for different selectors do
+// not share the same alert name.
+//
+// Since non-alphanumeric characters are removed and words are title-cased during name
+// generation, different selectors can result in the same name, e.g. foo{path="a-b"}
+// and foo{path="a_b"}. In such a case, a short hash of the absence alert rule
+// expression is appended to each of the conflicting names. The hash only depends on the
+// expression so the resulting names are deterministic.
+func disambiguateAlertNames(groups []monitoringv1.RuleGroup) {
+	exprs := make(map[string]map[string]bool)
+	for _, g := range groups {
+		for _, r := range g.Rules {
+			if exprs[r.Alert] == nil {
+				exprs[r.Alert] = make(map[string]bool)
+			}
+			exprs[r.Alert][r.Expr.String()] = true
+		}
 	}
 
-	// Sort alert rules for consistent test results.
-	sort.SliceStable(out, func(i, j int) bool {
-		return out[i].Alert < out[j].Alert
-	})
-	return out, nil
+	for _, g := range groups {
+		for i, r := range g.Rules {
+			if len(exprs[r.Alert]) > 1 {
+				h := fnv.New32a()
+				h.Write([]byte(r.Expr.String()))
+				g.Rules[i].Alert = fmt.Sprintf("%s%08x", r.Alert, h.Sum32())
+			}
+		}
+	}
 }
@@ -22,7 +22,7 @@ var _ = Describe("Alert Rule", func() {
 	DescribeTable("Parsing alert rule expressions",
 		func(in monitoringv1.Rule, out []monitoringv1.Rule) {
 			expected := out
-			actual, err := parseRule(logger, in, keepLabel)
+			actual, err := parseRule(logger, in, RuleOptions{KeepLabel: keepLabel})
 			Expect(err).ToNot(HaveOccurred())
 			Expect(actual).To(HaveLen(len(expected)))
 
@@ -171,6 +171,49 @@ var _ = Describe("Alert Rule", func() {
 				},
 			}},
 		),
+		Entry("alert rule that uses a regex alternation against the internal '__name__' label in expression",
+			monitoringv1.Rule{
+				Alert: "OpenstackLimesScrapeErrors",
+				Expr:  intstr.FromString(`sum(increase({__name__=~"limes_failed_scrapes|limes_suspended_scrapes"}[15m])) > 0`),
+				Labels: map[string]string{
+					"support_group": "containers",
+					"service":       "limes",
+				},
+			},
+			[]monitoringv1.Rule{
+				{
+					Alert: "AbsentContainersLimesFailedScrapes",
+					Expr:  intstr.FromString(`absent(limes_failed_scrapes)`),
+					Labels: map[string]string{
+						"context":       "absent-metrics",
+						"severity":      "info",
+						"support_group": "containers",
+						"service":       "limes",
+					},
+				},
+				{
+					Alert: "AbsentContainersLimesSuspendedScrapes",
+					Expr:  intstr.FromString(`absent(limes_suspended_scrapes)`),
+					Labels: map[string]string{
+						"context":       "absent-metrics",
+						"severity":      "info",
+						"support_group": "containers",
+						"service":       "limes",
+					},
+				},
+			},
+		),
+		Entry("alert rule that uses an unbounded regex against the internal '__name__' label in expression",
+			monitoringv1.Rule{
+				Alert: "OpenstackLimesScrapeErrors",
+				Expr:  intstr.FromString(`sum(increase({__name__=~"limes_.*_scrapes"}[15m])) > 0`),
+				Labels: map[string]string{
+					"support_group": "containers",
+					"service":       "limes",
+				},
+			},
+			nil, // the metric names can not be determined
+		),
 		Entry("alert rule that already uses 'absent' function for the metric used in the expression",
 			monitoringv1.Rule{
 				Alert: "OpenstackLimesFailedScrapes",
@@ -228,4 +271,467 @@ var _ = Describe("Alert Rule", func() {
 			nil, // absence alerts are not generated for record rules
 		),
 	)
+
+	DescribeTable("Parsing alert rule expressions with label matchers",
+		func(expr string, expected map[string]string) {
+			in := monitoringv1.Rule{
+				Alert:  "SomeAlert",
+				Expr:   intstr.FromString(expr),
+				Labels: map[string]string{"service": "foo"},
+			}
+			actual, err := parseRule(logger, in, RuleOptions{KeepLabel: keepLabel, KeepLabelMatchers: true})
+			Expect(err).ToNot(HaveOccurred())
+			rules := make(map[string]string, len(actual))
+			for _, r := range actual {
+				rules[r.Alert] = r.Expr.String()
+			}
+			Expect(rules).To(Equal(expected))
+		},
+		Entry("metric without label matchers",
+			`sum(rate(http_requests_total[5m])) > 0`,
+			map[string]string{"AbsentFooHttpRequestsTotal": `absent(http_requests_total)`},
+		),
+		Entry("equality matchers are retained in sorted order",
+			`kube_pod_failed_scheduling_memory_total{pod="foo",namespace="keppel"} > 0`,
+			map[string]string{
+				"AbsentFooKubePodFailedSchedulingMemoryTotalNamespaceKeppelPodFoo": `absent(kube_pod_failed_scheduling_memory_total{namespace="keppel",pod="foo"})`,
+			},
+		),
+		Entry("regex and negative matchers are dropped",
+			`http_requests_total{kubernetes_namespace="limes",code=~"5.*",method!="GET",path!~"/healthcheck.*"} > 0`,
+			map[string]string{
+				"AbsentFooHttpRequestsTotalKubernetesNamespaceLimes": `absent(http_requests_total{kubernetes_namespace="limes"})`,
+			},
+		),
+		Entry("templated matchers are dropped",
+			`up_foo{region="$region",cluster="{{ .Values.cluster }}",job="bar"} == 0`,
+			map[string]string{"AbsentFooUpFooJobBar": `absent(up_foo{job="bar"})`},
+		),
+		Entry("equality matcher against the internal '__name__' label",
+			`{__name__="limes_failed_scrapes",service="compute"} > 0`,
+			map[string]string{
+				"AbsentFooLimesFailedScrapesServiceCompute": `absent(limes_failed_scrapes{service="compute"})`,
+			},
+		),
+		Entry("same metric with different label matchers",
+			`up_foo{region="a"} == 0 or up_foo{region="b"} == 0`,
+			map[string]string{
+				"AbsentFooUpFooRegionA": `absent(up_foo{region="a"})`,
+				"AbsentFooUpFooRegionB": `absent(up_foo{region="b"})`,
+			},
+		),
+		Entry("same metric with the same label matchers in a different order",
+			`up_foo{region="a",job="bar"} == 0 or up_foo{job="bar",region="a",code=~"5.."} == 0`,
+			map[string]string{"AbsentFooUpFooJobBarRegionA": `absent(up_foo{job="bar",region="a"})`},
+		),
+		Entry("absent() with different retained label matchers",
+			`absent(up_foo{region="a"}) or up_foo{region="b"} == 0`,
+			map[string]string{"AbsentFooUpFooRegionB": `absent(up_foo{region="b"})`},
+		),
+		Entry("absent() with the same retained label matchers",
+			`absent(up_foo{region="a",code=~"5.."}) or up_foo{region="a"} == 0`,
+			map[string]string{},
+		),
+		Entry("label values with special characters are quoted",
+			`foo_total{path="C:\\dir\"quoted\""} > 0`,
+			map[string]string{"AbsentFooTotalPathCDirQuoted": `absent(foo_total{path="C:\\dir\"quoted\""})`},
+		),
+	)
+
+	DescribeTable("Detecting existing absent() functions in alert rule expressions",
+		func(expr string, expected []string) {
+			in := monitoringv1.Rule{
+				Alert: "SomeAlert",
+				Expr:  intstr.FromString(expr),
+			}
+			actual, err := parseRule(logger, in, RuleOptions{KeepLabel: keepLabel})
+			Expect(err).ToNot(HaveOccurred())
+			exprs := make([]string, 0, len(actual))
+			for _, r := range actual {
+				exprs = append(exprs, r.Expr.String())
+			}
+			Expect(exprs).To(ConsistOf(expected))
+		},
+		Entry("absent() with whitespace",
+			`absent( foo ) or foo > 0`,
+			[]string{},
+		),
+		Entry("absent() after the usage of the metric",
+			`foo > 0 or absent(foo)`,
+			[]string{},
+		),
+		Entry("absent() with parentheses around the argument",
+			`absent((foo)) or foo > 0`,
+			[]string{},
+		),
+		Entry("absent() with the internal '__name__' label",
+			`absent({__name__="foo"}) or foo > 0`,
+			[]string{},
+		),
+		Entry("absent_over_time()",
+			`absent_over_time(foo[5m]) or foo > 0`,
+			[]string{},
+		),
+		Entry("absent() for a metric whose name is a prefix of the name of another metric",
+			`absent(foo_total) or foo > 0`,
+			[]string{`absent(foo)`},
+		),
+		Entry("absent() for a metric whose name has the name of another metric as prefix",
+			`absent(foo) or foo_total > 0`,
+			[]string{`absent(foo_total)`},
+		),
+		Entry("absent() with the same label matchers in a different order",
+			`absent(foo{a="1",b="2"}) or foo{b="2",a="1"} > 0`,
+			[]string{},
+		),
+		Entry("absent() with different label matchers that are not retained",
+			`absent(foo{a="1"}) or foo{a="2"} > 0`,
+			[]string{},
+		),
+		Entry("absent() without label matchers for a metric that is used with label matchers",
+			`absent(foo) or foo{a="1"} > 0`,
+			[]string{},
+		),
+		Entry("absent() of an aggregation does not guard the metric",
+			`absent(sum(foo)) or foo > 0`,
+			[]string{`absent(foo)`},
+		),
+		Entry("absent() in a string literal",
+			`label_replace(foo, "dst", "absent(bar)", "src", ".*") > 0 or bar > 0`,
+			[]string{`absent(foo)`, `absent(bar)`},
+		),
+		Entry("absent() with an unbounded regex does not report an unresolved selector",
+			`absent({__name__=~"foo_.*"}) or foo_total > 0`,
+			[]string{`absent(foo_total)`},
+		),
+	)
+
+	DescribeTable("Absence alert rule expression and duration",
+		func(opts RuleOptions, annotations map[string]string, expectedExpr, expectedFor string) {
+			in := monitoringv1.Rule{
+				Alert:       "SomeAlert",
+				Expr:        intstr.FromString(`pushgateway_job_last_success_time{job="backup"} < time() - 86400`),
+				Annotations: annotations,
+			}
+			opts.KeepLabel = keepLabel
+			actual, err := parseRule(logger, in, opts)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actual).To(HaveLen(1))
+			Expect(actual[0].Expr.String()).To(Equal(expectedExpr))
+			Expect(actual[0].For).ToNot(BeNil())
+			Expect(string(*actual[0].For)).To(Equal(expectedFor))
+		},
+		Entry("default options",
+			RuleOptions{}, nil,
+			`absent(pushgateway_job_last_success_time)`, "10m",
+		),
+		Entry("over_time mode with default range",
+			RuleOptions{AbsenceMode: AbsenceModeOverTime}, nil,
+			`absent_over_time(pushgateway_job_last_success_time[1h])`, "10m",
+		),
+		Entry("over_time mode with custom range and for duration",
+			RuleOptions{AbsenceMode: AbsenceModeOverTime, AbsenceRange: "2h", AbsenceFor: "30m"}, nil,
+			`absent_over_time(pushgateway_job_last_success_time[2h])`, "30m",
+		),
+		Entry("over_time mode with label matchers",
+			RuleOptions{AbsenceMode: AbsenceModeOverTime, KeepLabelMatchers: true}, nil,
+			`absent_over_time(pushgateway_job_last_success_time{job="backup"}[1h])`, "10m",
+		),
+		Entry("options overridden by alert rule annotations",
+			RuleOptions{AbsenceMode: AbsenceModeAbsent, AbsenceFor: "30m"},
+			map[string]string{
+				"absent-metrics-operator/absence-mode":  "over_time",
+				"absent-metrics-operator/absence-range": "6h",
+				"absent-metrics-operator/absence-for":   "1h",
+			},
+			`absent_over_time(pushgateway_job_last_success_time[6h])`, "1h",
+		),
+		Entry("over_time mode overridden to absent by alert rule annotation",
+			RuleOptions{AbsenceMode: AbsenceModeOverTime},
+			map[string]string{"absent-metrics-operator/absence-mode": "absent"},
+			`absent(pushgateway_job_last_success_time)`, "10m",
+		),
+	)
+
+	DescribeTable("Absence alert rule 'for' duration policy",
+		func(policy string, sourceFor, expectedFor string) {
+			p, err := ParseAbsenceForPolicy(policy)
+			Expect(err).ToNot(HaveOccurred())
+			in := monitoringv1.Rule{
+				Alert: "SomeAlert",
+				Expr:  intstr.FromString(`foo > 0`),
+			}
+			if sourceFor != "" {
+				d := monitoringv1.Duration(sourceFor)
+				in.For = &d
+			}
+			actual, err := parseRule(logger, in, RuleOptions{KeepLabel: keepLabel, AbsenceForPolicy: p})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actual).To(HaveLen(1))
+			Expect(string(*actual[0].For)).To(Equal(expectedFor))
+		},
+		Entry("fixed policy ignores the source duration", "fixed", "2h", "10m"),
+		Entry("max policy with a longer source duration", "max", "2h", "2h"),
+		Entry("max policy with a shorter source duration", "max", "1m", "10m"),
+		Entry("max policy without a source duration", "max", "", "10m"),
+		Entry("multiply policy", "multiply:2", "15m", "30m"),
+		Entry("multiply policy with a fractional factor", "multiply:1.5", "1h", "1h30m"),
+		Entry("multiply policy without a source duration", "multiply:3", "", "10m"),
+	)
+
+	It("uses the largest 'for' duration when several alert rules use the same metric", func() {
+		forDuration := func(d string) *monitoringv1.Duration {
+			v := monitoringv1.Duration(d)
+			return &v
+		}
+		in := []monitoringv1.RuleGroup{
+			{
+				Name: "foo.alerts",
+				Rules: []monitoringv1.Rule{
+					{Alert: "FooInfo", Expr: intstr.FromString(`foo_total > 0`), For: forDuration("1h")},
+					{Alert: "FooCritical", Expr: intstr.FromString(`foo_total > 10`), For: forDuration("5m")},
+				},
+			},
+			{
+				Name: "bar.alerts",
+				Rules: []monitoringv1.Rule{
+					{Alert: "FooWarning", Expr: intstr.FromString(`foo_total > 5`), For: forDuration("30m")},
+					{Alert: "Bar", Expr: intstr.FromString(`bar_total > 0`), For: forDuration("5m")},
+				},
+			},
+		}
+		opts := RuleOptions{KeepLabel: keepLabel, AbsenceFor: "1m", AbsenceForPolicy: AbsenceForPolicy{Kind: AbsenceForPolicyMax}}
+		actual, err := ParseRuleGroups(logger, in, "foo", opts)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(HaveLen(2))
+
+		Expect(actual[0].Rules).To(HaveLen(1))
+		Expect(actual[0].Rules[0].Expr.String()).To(Equal(`absent(foo_total)`))
+		Expect(string(*actual[0].Rules[0].For)).To(Equal("1h"))
+
+		Expect(actual[1].Rules).To(HaveLen(2))
+		Expect(actual[1].Rules[0].Expr.String()).To(Equal(`absent(bar_total)`))
+		Expect(string(*actual[1].Rules[0].For)).To(Equal("5m"))
+		Expect(actual[1].Rules[1].Expr.String()).To(Equal(`absent(foo_total)`))
+		Expect(string(*actual[1].Rules[1].For)).To(Equal("1h"))
+	})
+
+	DescribeTable("Absence alert rule severity",
+		func(severityMap, sourceSeverity, expectedSeverity, expectedSourceSeverity string) {
+			m, err := ParseSeverityMap(severityMap)
+			Expect(err).ToNot(HaveOccurred())
+			in := monitoringv1.Rule{
+				Alert:  "SomeAlert",
+				Expr:   intstr.FromString(`foo > 0`),
+				Labels: map[string]string{"severity": sourceSeverity},
+			}
+			actual, err := parseRule(logger, in, RuleOptions{KeepLabel: keepLabel, SeverityMap: m})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actual).To(HaveLen(1))
+			Expect(actual[0].Labels).To(HaveKeyWithValue("severity", expectedSeverity))
+			if expectedSourceSeverity == "" {
+				Expect(actual[0].Annotations).ToNot(HaveKey("source_severity"))
+			} else {
+				Expect(actual[0].Annotations).To(HaveKeyWithValue("source_severity", expectedSourceSeverity))
+			}
+		},
+		Entry("without severity map", "", "critical", "info", ""),
+		Entry("mapped severity", "critical=warning,warning=info", "critical", "warning", "critical"),
+		Entry("unmapped severity", "critical=warning,warning=info", "debug", "info", ""),
+		Entry("templated severity", "critical=warning", "{{ $labels.severity }}", "info", ""),
+	)
+
+	It("uses the severity with the highest priority when several alert rules use the same metric", func() {
+		m, err := ParseSeverityMap("critical=warning,warning=info")
+		Expect(err).ToNot(HaveOccurred())
+		in := []monitoringv1.RuleGroup{
+			{
+				Name: "foo.alerts",
+				Rules: []monitoringv1.Rule{
+					{Alert: "FooWarning", Expr: intstr.FromString(`foo_total > 5`), Labels: map[string]string{"severity": "warning"}},
+					{Alert: "Bar", Expr: intstr.FromString(`bar_total > 0`), Labels: map[string]string{"severity": "warning"}},
+				},
+			},
+			{
+				Name: "bar.alerts",
+				Rules: []monitoringv1.Rule{
+					{Alert: "FooCritical", Expr: intstr.FromString(`foo_total > 10`), Labels: map[string]string{"severity": "critical"}},
+					{Alert: "FooInfo", Expr: intstr.FromString(`foo_total > 0`), Labels: map[string]string{"severity": "info"}},
+				},
+			},
+		}
+		actual, err := ParseRuleGroups(logger, in, "foo", RuleOptions{KeepLabel: keepLabel, SeverityMap: m})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(HaveLen(2))
+
+		Expect(actual[0].Rules).To(HaveLen(2))
+		Expect(actual[0].Rules[0].Expr.String()).To(Equal(`absent(bar_total)`))
+		Expect(actual[0].Rules[0].Labels).To(HaveKeyWithValue("severity", "info"))
+		Expect(actual[0].Rules[1].Expr.String()).To(Equal(`absent(foo_total)`))
+		Expect(actual[0].Rules[1].Labels).To(HaveKeyWithValue("severity", "warning"))
+		Expect(actual[0].Rules[1].Annotations).To(HaveKeyWithValue("source_severity", "critical"))
+
+		Expect(actual[1].Rules).To(HaveLen(1))
+		Expect(actual[1].Rules[0].Labels).To(HaveKeyWithValue("severity", "warning"))
+		Expect(actual[1].Rules[0].Annotations).To(HaveKeyWithValue("source_severity", "critical"))
+	})
+
+	It("lists all alert rules that use a metric", func() {
+		tmpl, err := ParseAbsenceRuleTemplate(`
+expr: {{ quote .expr }}
+annotations:
+  description: {{ quote (printf "used by: %s" (join .sourceAlerts ", ")) }}
+`)
+		Expect(err).ToNot(HaveOccurred())
+		in := []monitoringv1.RuleGroup{
+			{
+				Name: "foo.alerts",
+				Rules: []monitoringv1.Rule{
+					{Alert: "FooHigh", Expr: intstr.FromString(`foo_total > 10`)},
+					{Alert: "Bar", Expr: intstr.FromString(`bar_total > 0`)},
+				},
+			},
+			{
+				Name: "bar.alerts",
+				Rules: []monitoringv1.Rule{
+					{Alert: "FooLow", Expr: intstr.FromString(`foo_total < 1`)},
+					{Alert: "FooHigh", Expr: intstr.FromString(`foo_total > 100`)},
+				},
+			},
+		}
+		actual, err := ParseRuleGroups(logger, in, "foo", RuleOptions{KeepLabel: keepLabel, Template: tmpl})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(HaveLen(2))
+
+		Expect(actual[0].Rules).To(HaveLen(2))
+		Expect(actual[0].Rules[0].Annotations).To(Equal(map[string]string{
+			"description":   "used by: Bar",
+			"source_alerts": `["Bar"]`,
+		}))
+		Expect(actual[0].Rules[1].Annotations).To(Equal(map[string]string{
+			"description":   "used by: FooHigh, FooLow",
+			"source_alerts": `["FooHigh","FooLow"]`,
+		}))
+		Expect(actual[1].Rules).To(HaveLen(1))
+		Expect(actual[1].Rules[0].Annotations).To(Equal(actual[0].Rules[1].Annotations))
+	})
+
+	DescribeTable("Invalid severity maps",
+		func(in string) {
+			_, err := ParseSeverityMap(in)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("missing target", "critical"),
+		Entry("empty target", "critical="),
+		Entry("duplicate source", "critical=warning,critical=info"),
+	)
+
+	DescribeTable("Invalid option annotations",
+		func(annotations map[string]string) {
+			in := monitoringv1.Rule{
+				Alert:       "SomeAlert",
+				Expr:        intstr.FromString(`foo > 0`),
+				Annotations: annotations,
+			}
+			_, err := parseRule(logger, in, RuleOptions{KeepLabel: keepLabel})
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("invalid absence mode", map[string]string{"absent-metrics-operator/absence-mode": "sometimes"}),
+		Entry("invalid absence range", map[string]string{"absent-metrics-operator/absence-range": "1 hour"}),
+		Entry("invalid for duration", map[string]string{"absent-metrics-operator/absence-for": "-5m"}),
+		Entry("invalid boolean", map[string]string{"absent-metrics-operator/keep-label-matchers": "yes"}),
+		Entry("invalid for policy", map[string]string{"absent-metrics-operator/absence-for-policy": "min"}),
+		Entry("invalid for policy factor", map[string]string{"absent-metrics-operator/absence-for-policy": "multiply:0"}),
+	)
+
+	It("skips metrics that are excluded by the metric name filter", func() {
+		in := monitoringv1.Rule{
+			Alert: "SomeAlert",
+			Expr:  intstr.FromString(`ALERTS{alertstate="firing"} > 0 or limes_api_errors_total > 0 or limes_failed_scrapes > 0`),
+		}
+		filter, err := NewMetricNameFilter([]string{"ALERTS", "*_errors_total"}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		actual, err := parseRule(logger, in, RuleOptions{KeepLabel: keepLabel, MetricNameFilter: filter})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(HaveLen(1))
+		Expect(actual[0].Expr.String()).To(Equal(`absent(limes_failed_scrapes)`))
+	})
+
+	It("reports selectors for which no metric name could be determined", func() {
+		in := monitoringv1.Rule{
+			Alert: "SomeAlert",
+			Expr:  intstr.FromString(`{__name__=~"foo_.*"} > 0 or {__name__!~"bar_.*",job="bar"} > 0 or {__name__=~"baz_total"} > 0`),
+		}
+		var unresolved []string
+		opts := RuleOptions{
+			KeepLabel: keepLabel,
+			OnUnresolvedSelector: func(alert, selector string) {
+				Expect(alert).To(Equal("SomeAlert"))
+				unresolved = append(unresolved, selector)
+			},
+		}
+		actual, err := parseRule(logger, in, opts)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(HaveLen(1))
+		Expect(actual[0].Expr.String()).To(Equal(`absent(baz_total)`))
+		Expect(unresolved).To(ConsistOf(`{__name__=~"foo_.*"}`, `{__name__!~"bar_.*",job="bar"}`))
+	})
+
+	It("reports the metrics that are skipped", func() {
+		filter, err := NewMetricNameFilter([]string{"limes_*"}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		skipped := make(map[SkipReason][]string)
+		opts := RuleOptions{
+			KeepLabel:        keepLabel,
+			MetricNameFilter: filter,
+			OnSkippedMetric: func(_, metric string, reason SkipReason) {
+				skipped[reason] = append(skipped[reason], metric)
+			},
+		}
+		for _, in := range []monitoringv1.Rule{
+			{Alert: "Foo", Expr: intstr.FromString(`foo_total > 0 or absent(bar_total) or bar_total > 0`)},
+			{Alert: "Up", Expr: intstr.FromString(`up == 0 or limes_foo > 0 or {__name__=~"baz_.*"} > 0`)},
+			{Alert: "Disabled", Expr: intstr.FromString(`qux_total > 0`), Labels: map[string]string{labelNoAlertOnAbsence: "true"}},
+		} {
+			_, err := parseRule(logger, in, opts)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(skipped).To(Equal(map[SkipReason][]string{
+			SkipReasonGuarded:          {"bar_total"},
+			SkipReasonUp:               {"up"},
+			SkipReasonFiltered:         {"limes_foo"},
+			SkipReasonUnresolved:       {`{__name__=~"baz_.*"}`},
+			SkipReasonNoAlertOnAbsence: {""},
+		}))
+	})
+
+	It("generates distinct names for selectors that would otherwise result in the same alert name", func() {
+		in := []monitoringv1.RuleGroup{{
+			Name: "foo.alerts",
+			Rules: []monitoringv1.Rule{
+				{Alert: "FooA", Expr: intstr.FromString(`foo_total{path="a-b"} > 0`)},
+				{Alert: "FooB", Expr: intstr.FromString(`foo_total{path="a_b"} > 0`)},
+				{Alert: "FooC", Expr: intstr.FromString(`bar_total{path="c"} > 0`)},
+			},
+		}}
+		opts := RuleOptions{KeepLabel: keepLabel, KeepLabelMatchers: true}
+		actual, err := ParseRuleGroups(logger, in, "foo", opts)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(HaveLen(1))
+
+		names := make(map[string]string)
+		for _, r := range actual[0].Rules {
+			names[r.Expr.String()] = r.Alert
+		}
+		Expect(names).To(HaveLen(3))
+		Expect(names[`absent(bar_total{path="c"})`]).To(Equal("AbsentBarTotalPathC"))
+		Expect(names[`absent(foo_total{path="a-b"})`]).To(HavePrefix("AbsentFooTotalPathAB"))
+		Expect(names[`absent(foo_total{path="a_b"})`]).To(HavePrefix("AbsentFooTotalPathAB"))
+		Expect(names[`absent(foo_total{path="a-b"})`]).ToNot(Equal(names[`absent(foo_total{path="a_b"})`]))
+
+		// The names must be stable across runs.
+		again, err := ParseRuleGroups(logger, in, "foo", opts)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(again).To(Equal(actual))
+	})
 })
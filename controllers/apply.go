@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"slices"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/csaupgrade"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// fieldManager is the field manager that is used for server-side apply of
+// AbsencePrometheusRules.
+//
+// Older versions of the operator used client-side patches. The API server derives the
+// field manager for these from the user agent, which is the same name.
+const fieldManager = "absent-metrics-operator"
+
+// These are the labels and annotations on AbsencePrometheusRules that are managed by the
+// operator. Other labels and annotations are left to other field managers.
+var (
+	managedLabels = []string{
+		labelOperatorManagedBy, "type", labelPrometheusServer, labelGreenhousePlugin, labelThanosRuler,
+	}
+	managedAnnotations = []string{
+		annotationOperatorUpdatedAt, annotationRuleGroupSources,
+	}
+)
+
+// applyAbsencePrometheusRule creates or updates the given AbsencePrometheusRule using
+// server-side apply. Only the fields that are managed by the operator are applied.
+//
+// If some of these fields are also managed by someone else, e.g. because the
+// AbsencePrometheusRule was changed manually, then the conflict is reported as an event
+// and the operator takes over the ownership of the fields.
+func (r *PrometheusRuleReconciler) applyAbsencePrometheusRule(ctx context.Context, absencePromRule *monitoringv1.PrometheusRule) error {
+	if err := r.migrateManagedFields(ctx, absencePromRule); err != nil {
+		return err
+	}
+
+	obj, err := appliedAbsencePrometheusRule(absencePromRule, r.Scope.copiedLabels())
+	if err != nil {
+		return err
+	}
+	err = r.Apply(ctx, client.ApplyConfigurationFromUnstructured(obj), client.FieldOwner(fieldManager))
+	if apierrors.IsConflict(err) {
+		r.recordEvent(absencePromRule, corev1.EventTypeWarning, eventReasonFieldConflict,
+			"Taking over fields of AbsencePrometheusRule that are managed by someone else: %s", err.Error())
+		err = r.Apply(ctx, client.ApplyConfigurationFromUnstructured(obj), client.FieldOwner(fieldManager), client.ForceOwnership)
+	}
+	if err != nil {
+		return err
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, absencePromRule)
+}
+
+// appliedAbsencePrometheusRule returns the fields of the given AbsencePrometheusRule that
+// are managed by the operator. The copiedLabels are managed in addition to the
+// managedLabels, see Scope.
+func appliedAbsencePrometheusRule(absencePromRule *monitoringv1.PrometheusRule, copiedLabels []string) (*unstructured.Unstructured, error) {
+	pick := func(in map[string]string, keys []string) map[string]string {
+		out := make(map[string]string)
+		for k, v := range in {
+			if slices.Contains(keys, k) {
+				out[k] = v
+			}
+		}
+		return out
+	}
+	var ownerRefs []metav1.OwnerReference
+	for _, ref := range absencePromRule.GetOwnerReferences() {
+		if isPrometheusRuleOwnerReference(ref) {
+			ownerRefs = append(ownerRefs, ref)
+		}
+	}
+	applied := &monitoringv1.PrometheusRule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            absencePromRule.GetName(),
+			Namespace:       absencePromRule.GetNamespace(),
+			Labels:          pick(absencePromRule.GetLabels(), slices.Concat(managedLabels, copiedLabels)),
+			Annotations:     pick(absencePromRule.GetAnnotations(), managedAnnotations),
+			OwnerReferences: ownerRefs,
+		},
+		Spec: absencePromRule.Spec,
+	}
+
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(applied)
+	if err != nil {
+		return nil, err
+	}
+	obj := &unstructured.Unstructured{Object: u}
+	obj.SetGroupVersionKind(monitoringv1.SchemeGroupVersion.WithKind(monitoringv1.PrometheusRuleKind))
+	unstructured.RemoveNestedField(obj.Object, "metadata", "creationTimestamp")
+	return obj, nil
+}
+
+// migrateManagedFields transfers the ownership of the fields that were written with
+// client-side patches by an older version of the operator to server-side apply.
+// Otherwise, fields that are no longer applied, e.g. a rule group whose PrometheusRule
+// was deleted, would not be removed.
+func (r *PrometheusRuleReconciler) migrateManagedFields(ctx context.Context, absencePromRule *monitoringv1.PrometheusRule) error {
+	if len(absencePromRule.GetManagedFields()) == 0 {
+		// The AbsencePrometheusRule does not exist yet.
+		return nil
+	}
+	patch, err := csaupgrade.UpgradeManagedFieldsPatch(absencePromRule, sets.New(fieldManager), fieldManager)
+	if err != nil || patch == nil {
+		return err
+	}
+	// The patch is applied to a copy since the given AbsencePrometheusRule has already
+	// been modified and would otherwise be overwritten with the response.
+	return r.Patch(ctx, absencePromRule.DeepCopy(), client.RawPatch(types.JSONPatchType, patch))
+}
@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var _ = Describe("Server-side apply", func() {
+	It("only applies the fields that are managed by the operator", func() {
+		ownerRef := metav1.OwnerReference{
+			APIVersion: "monitoring.coreos.com/v1",
+			Kind:       "PrometheusRule",
+			Name:       "openstack-limes-api.alerts",
+			UID:        "8a4c2f5e-6f2a-4b8e-9d6c-3b1f0e7a9c21",
+		}
+		aPR := &monitoringv1.PrometheusRule{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "openstack-absent-metric-alert-rules",
+				Namespace:       "resmgmt",
+				ResourceVersion: "42",
+				UID:             "0d9e3b7a-1c4f-4e2b-8a6d-5f2c9b1e7d43",
+				Labels: map[string]string{
+					labelOperatorManagedBy:       "true",
+					"type":                       "alerting-rules",
+					"prometheus":                 "openstack",
+					"app.kubernetes.io/instance": "gitops",
+				},
+				Annotations: map[string]string{
+					annotationOperatorUpdatedAt:   "1970-01-01T00:00:01Z",
+					annotationManualOverride:      "false",
+					"argocd.argoproj.io/tracking": "foo",
+				},
+				OwnerReferences: []metav1.OwnerReference{
+					ownerRef,
+					{APIVersion: "v1", Kind: "ConfigMap", Name: "foo", UID: "1f6e2d8c-3b5a-4c7e-9f0d-2a4b6c8e0f13"},
+				},
+			},
+			Spec: monitoringv1.PrometheusRuleSpec{
+				Groups: []monitoringv1.RuleGroup{{
+					Name:  "openstack-limes-api.alerts/api.alerts",
+					Rules: []monitoringv1.Rule{{Alert: "AbsentContainersLimesFoo", Expr: intstr.FromString("absent(limes_foo)")}},
+				}},
+			},
+		}
+
+		obj, err := appliedAbsencePrometheusRule(aPR, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(obj.GetAPIVersion()).To(Equal("monitoring.coreos.com/v1"))
+		Expect(obj.GetKind()).To(Equal("PrometheusRule"))
+		Expect(obj.GetName()).To(Equal(aPR.Name))
+		Expect(obj.GetNamespace()).To(Equal(aPR.Namespace))
+		Expect(obj.GetResourceVersion()).To(BeEmpty())
+		Expect(obj.GetUID()).To(BeEmpty())
+		Expect(obj.GetLabels()).To(Equal(map[string]string{
+			labelOperatorManagedBy: "true",
+			"type":                 "alerting-rules",
+			"prometheus":           "openstack",
+		}))
+		Expect(obj.GetAnnotations()).To(Equal(map[string]string{annotationOperatorUpdatedAt: "1970-01-01T00:00:01Z"}))
+		Expect(obj.GetOwnerReferences()).To(Equal([]metav1.OwnerReference{ownerRef}))
+		Expect(obj.Object).ToNot(HaveKey("status"))
+		Expect(obj.Object["metadata"]).ToNot(HaveKey("creationTimestamp"))
+		Expect(obj.Object["spec"]).To(HaveKeyWithValue("groups", HaveLen(1)))
+	})
+})
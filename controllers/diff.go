@@ -0,0 +1,297 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/sapcc/go-bits/errext"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+
+	absentmetricsv1alpha1 "github.com/sapcc/absent-metrics-operator/api/v1alpha1"
+)
+
+// ObjectDiff is the unified diff of an AbsencePrometheusRule. For an
+// AbsencePrometheusRule that would be created or deleted, the diff is against an empty
+// object.
+type ObjectDiff struct {
+	Namespace string
+	Name      string
+	Diff      string
+}
+
+// Diff computes the changes that the operator would make to the AbsencePrometheusRules
+// that can be read with the given client, e.g. after its flags have been changed. The
+// client can be a live client or a fake client that is loaded from a dump of the
+// cluster.
+//
+// The objects that are taken into account by the operator, i.e. PrometheusRules,
+// AbsencePrometheusRules, Namespaces, policies, and the metric name filter ConfigMap,
+// are copied into a fake client against which the reconciler runs in dry-run mode: it
+// generates the absence alert rules for each PrometheusRule and then cleans up each
+// AbsencePrometheusRule. The operations that are recorded instead of being executed
+// make up the diff. They are also applied to the fake client so that each
+// reconciliation sees the result of the previous ones. Nothing is written with the
+// given client and the reconciler is not modified.
+func (r *PrometheusRuleReconciler) Diff(ctx context.Context, reader client.Reader) ([]ObjectDiff, error) {
+	objs, err := r.listDiffObjects(ctx, reader)
+	if err != nil {
+		return nil, err
+	}
+	initObjs := make([]client.Object, 0, len(objs))
+	namespaces := make(map[string]bool)
+	for _, obj := range objs {
+		obj, ok := obj.DeepCopyObject().(client.Object)
+		if !ok {
+			continue
+		}
+		obj.SetResourceVersion("")
+		initObjs = append(initObjs, obj)
+		if _, ok := obj.(*corev1.Namespace); ok {
+			namespaces[obj.GetName()] = true
+		}
+	}
+	// A namespace that can not be found is treated as if it had no labels.
+	for _, obj := range objs {
+		if ns := obj.GetNamespace(); ns != "" && !namespaces[ns] {
+			namespaces[ns] = true
+			initObjs = append(initObjs, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}})
+		}
+	}
+	c := fake.NewClientBuilder().WithScheme(r.Scheme).WithObjects(initObjs...).Build()
+
+	var absencePromRules monitoringv1.PrometheusRuleList
+	if err := c.List(ctx, &absencePromRules, client.HasLabels{labelOperatorManagedBy}); err != nil {
+		return nil, err
+	}
+	before := make(map[types.NamespacedName]*monitoringv1.PrometheusRule, len(absencePromRules.Items))
+	for _, aPR := range absencePromRules.Items {
+		if parseBool(aPR.Labels[labelOperatorManagedBy]) {
+			before[client.ObjectKeyFromObject(&aPR)] = &aPR
+		}
+	}
+	after := maps.Clone(before)
+
+	dr := &PrometheusRuleReconciler{
+		Client:                    c,
+		Scheme:                    r.Scheme,
+		Log:                       r.Log,
+		PrometheusRuleName:        r.PrometheusRuleName,
+		RuleOptions:               r.RuleOptions,
+		MetricNameFilterConfigMap: r.MetricNameFilterConfigMap,
+		AggregateSourceAlerts:     r.AggregateSourceAlerts,
+		EnablePolicies:            r.EnablePolicies,
+		UseFinalizer:              r.UseFinalizer,
+		Scope:                     r.Scope,
+		Mode:                      r.Mode,
+		APIReader:                 c,
+		DryRun:                    true,
+		dryRunRecorder: func(ctx context.Context, operation string, absencePromRule *monitoringv1.PrometheusRule) error {
+			key := client.ObjectKeyFromObject(absencePromRule)
+			obj := absencePromRule.DeepCopy()
+			switch operation {
+			case operationCreate:
+				after[key] = absencePromRule.DeepCopy()
+				return c.Create(ctx, obj)
+			case operationPatch:
+				after[key] = absencePromRule.DeepCopy()
+				var current monitoringv1.PrometheusRule
+				if err := c.Get(ctx, key, &current); err != nil {
+					return err
+				}
+				obj.ResourceVersion = current.ResourceVersion
+				return c.Update(ctx, obj)
+			case operationDelete:
+				delete(after, key)
+				return c.Delete(ctx, obj)
+			default:
+				return fmt.Errorf("unknown operation %q", operation)
+			}
+		},
+	}
+
+	// Step 1: generate the absence alert rules for each PrometheusRule, see Reconcile().
+	var promRules monitoringv1.PrometheusRuleList
+	if err := c.List(ctx, &promRules); err != nil {
+		return nil, err
+	}
+	for _, pr := range promRules.Items {
+		if parseBool(pr.Labels[labelOperatorManagedBy]) {
+			continue
+		}
+		key := client.ObjectKeyFromObject(&pr)
+		err := dr.reconcileObject(ctx, key, &pr)
+		if perr, ok := errext.As[*ruleGroupParseError](err); ok {
+			// The operator would leave the absence alert rules of this PrometheusRule
+			// as is.
+			dr.Log.Error(perr, "could not parse rule groups", "name", key.Name, "namespace", key.Namespace)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not reconcile PrometheusRule %s: %w", key, err)
+		}
+	}
+
+	// Step 2: clean up each AbsencePrometheusRule, e.g. after the name template has been
+	// changed.
+	absencePromRules = monitoringv1.PrometheusRuleList{}
+	if err := c.List(ctx, &absencePromRules, client.HasLabels{labelOperatorManagedBy}); err != nil {
+		return nil, err
+	}
+	for _, aPR := range absencePromRules.Items {
+		if !parseBool(aPR.Labels[labelOperatorManagedBy]) {
+			continue
+		}
+		if err := dr.cleanUpAbsencePrometheusRule(ctx, &aPR); err != nil {
+			return nil, fmt.Errorf("could not clean up AbsencePrometheusRule %s: %w", client.ObjectKeyFromObject(&aPR), err)
+		}
+	}
+
+	renderedBefore, err := renderAbsencePrometheusRules(before)
+	if err != nil {
+		return nil, err
+	}
+	renderedAfter, err := renderAbsencePrometheusRules(after)
+	if err != nil {
+		return nil, err
+	}
+	return diffRenderedObjects(renderedBefore, renderedAfter)
+}
+
+// listDiffObjects lists the objects that are taken into account by the operator with
+// the configuration of r.
+func (r *PrometheusRuleReconciler) listDiffObjects(ctx context.Context, reader client.Reader) ([]client.Object, error) {
+	lists := []client.ObjectList{
+		&monitoringv1.PrometheusRuleList{},
+		&corev1.NamespaceList{},
+	}
+	if r.EnablePolicies {
+		lists = append(lists,
+			&absentmetricsv1alpha1.ClusterAbsenceRulePolicyList{},
+			&absentmetricsv1alpha1.AbsenceRulePolicyList{},
+		)
+	}
+
+	var result []client.Object
+	for _, list := range lists {
+		if err := reader.List(ctx, list); err != nil {
+			return nil, err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if obj, ok := item.(client.Object); ok {
+				result = append(result, obj)
+			}
+		}
+	}
+
+	if r.MetricNameFilterConfigMap.Name != "" {
+		var cm corev1.ConfigMap
+		err := reader.Get(ctx, r.MetricNameFilterConfigMap, &cm)
+		switch {
+		case err == nil:
+			result = append(result, &cm)
+		case !apierrors.IsNotFound(err):
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// renderAbsencePrometheusRules returns the YAML representation of the given
+// AbsencePrometheusRules. Fields that change on every update are omitted.
+func renderAbsencePrometheusRules(absencePromRules map[types.NamespacedName]*monitoringv1.PrometheusRule) (map[types.NamespacedName]string, error) {
+	result := make(map[types.NamespacedName]string, len(absencePromRules))
+	for k, aPR := range absencePromRules {
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(aPR)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range []string{"creationTimestamp", "generation", "managedFields", "resourceVersion", "uid"} {
+			unstructured.RemoveNestedField(obj, "metadata", f)
+		}
+		unstructured.RemoveNestedField(obj, "metadata", "annotations", annotationOperatorUpdatedAt)
+		unstructured.RemoveNestedField(obj, "apiVersion")
+		unstructured.RemoveNestedField(obj, "kind")
+		buf, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		result[k] = string(buf)
+	}
+	return result, nil
+}
+
+// diffRenderedObjects returns the unified diffs of the objects that differ, sorted by
+// namespace and name.
+func diffRenderedObjects(before, after map[types.NamespacedName]string) ([]ObjectDiff, error) {
+	keys := make(map[types.NamespacedName]bool, len(before)+len(after))
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+
+	var result []ObjectDiff
+	for k := range keys {
+		a, b := before[k], after[k]
+		if a == b {
+			continue
+		}
+		fromFile, toFile := "a/"+k.String(), "b/"+k.String()
+		if a == "" {
+			fromFile = "/dev/null"
+		}
+		if b == "" {
+			toFile = "/dev/null"
+		}
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        splitLines(a),
+			B:        splitLines(b),
+			FromFile: fromFile,
+			ToFile:   toFile,
+			Context:  3,
+		})
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, ObjectDiff{Namespace: k.Namespace, Name: k.Name, Diff: diff})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// splitLines splits s after each newline. Unlike difflib.SplitLines, it does not add an
+// empty line at the end.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
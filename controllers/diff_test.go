@@ -0,0 +1,157 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+var _ = Describe("Diff", func() {
+	logger := zap.New(zap.UseDevMode(true))
+	ctx := context.Background()
+	scheme := newTestScheme()
+
+	newReconciler := func() *PrometheusRuleReconciler {
+		nameGen, err := CreateAbsencePromRuleNameGenerator(DefaultAbsencePromRuleNameTemplate)
+		Expect(err).ToNot(HaveOccurred())
+		return &PrometheusRuleReconciler{
+			Scheme:             scheme,
+			Log:                logger,
+			PrometheusRuleName: nameGen,
+			UseFinalizer:       true,
+		}
+	}
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "resmgmt"}}
+	promRule := &monitoringv1.PrometheusRule{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "resmgmt",
+			Name:      "openstack-limes-api.alerts",
+			Labels:    map[string]string{"prometheus": "openstack"},
+		},
+		Spec: monitoringv1.PrometheusRuleSpec{Groups: []monitoringv1.RuleGroup{{
+			Name:  "foo.alerts",
+			Rules: []monitoringv1.Rule{{Alert: "LimesFoo", Expr: intstr.FromString("limes_foo > 0")}},
+		}}},
+	}
+	absencePromRule := func(name string, sources ...string) *monitoringv1.PrometheusRule {
+		groups := make([]monitoringv1.RuleGroup, 0, len(sources))
+		for _, s := range sources {
+			groups = append(groups, monitoringv1.RuleGroup{
+				Name:  s + "/foo.alerts",
+				Rules: []monitoringv1.Rule{{Alert: "AbsentFoo", Expr: intstr.FromString("absent(foo)")}},
+			})
+		}
+		return &monitoringv1.PrometheusRule{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "resmgmt",
+				Name:      name,
+				Labels:    map[string]string{labelOperatorManagedBy: "true", "prometheus": "openstack"},
+			},
+			Spec: monitoringv1.PrometheusRuleSpec{Groups: groups},
+		}
+	}
+	// reconciledAbsencePromRule returns the AbsencePrometheusRule that the operator
+	// actually writes for the given PrometheusRule.
+	reconciledAbsencePromRule := func(promRule *monitoringv1.PrometheusRule) *monitoringv1.PrometheusRule {
+		c, _ := newFakeClient(scheme, namespace.DeepCopy(), promRule.DeepCopy())
+		r := newReconciler()
+		r.Client = c
+		r.APIReader = c
+		var pr monitoringv1.PrometheusRule
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(promRule), &pr)).To(Succeed())
+		Expect(r.reconcileObject(ctx, client.ObjectKeyFromObject(promRule), &pr)).To(Succeed())
+
+		var absencePromRules monitoringv1.PrometheusRuleList
+		Expect(c.List(ctx, &absencePromRules, client.HasLabels{labelOperatorManagedBy})).To(Succeed())
+		Expect(absencePromRules.Items).To(HaveLen(1))
+		return &absencePromRules.Items[0]
+	}
+
+	It("shows the AbsencePrometheusRules that would be created", func() {
+		c, writes := newFakeClient(scheme, namespace.DeepCopy(), promRule.DeepCopy())
+		diffs, err := newReconciler().Diff(ctx, c)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diffs).To(HaveLen(1))
+		Expect(diffs[0].Namespace).To(Equal("resmgmt"))
+		Expect(diffs[0].Name).To(Equal("openstack-absent-metric-alert-rules"))
+		Expect(diffs[0].Diff).To(HavePrefix("--- /dev/null\n+++ b/resmgmt/openstack-absent-metric-alert-rules\n"))
+		Expect(diffs[0].Diff).To(ContainSubstring("+  - name: openstack-limes-api.alerts/foo.alerts\n"))
+		Expect(diffs[0].Diff).To(ContainSubstring("+      expr: absent(limes_foo)\n"))
+
+		// Nothing is written with the given client.
+		Expect(*writes).To(BeEmpty())
+	})
+
+	It("shows no changes for AbsencePrometheusRules that are up to date", func() {
+		c, writes := newFakeClient(scheme, namespace.DeepCopy(), promRule.DeepCopy(), reconciledAbsencePromRule(promRule))
+		diffs, err := newReconciler().Diff(ctx, c)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diffs).To(BeEmpty())
+		Expect(*writes).To(BeEmpty())
+	})
+
+	It("shows the AbsencePrometheusRules that would be changed or deleted", func() {
+		// The existing absence alert rules of openstack-limes-api.alerts are outdated,
+		// and openstack-limes-roleassign.alerts and kubernetes-keppel.alerts no longer
+		// exist.
+		c, writes := newFakeClient(scheme,
+			namespace.DeepCopy(),
+			promRule.DeepCopy(),
+			absencePromRule("openstack-absent-metric-alert-rules", "openstack-limes-api.alerts", "openstack-limes-roleassign.alerts"),
+			absencePromRule("kubernetes-absent-metric-alert-rules", "kubernetes-keppel.alerts"),
+		)
+		diffs, err := newReconciler().Diff(ctx, c)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diffs).To(HaveLen(2))
+
+		Expect(diffs[0].Name).To(Equal("kubernetes-absent-metric-alert-rules"))
+		Expect(diffs[0].Diff).To(HavePrefix("--- a/resmgmt/kubernetes-absent-metric-alert-rules\n+++ /dev/null\n"))
+
+		Expect(diffs[1].Name).To(Equal("openstack-absent-metric-alert-rules"))
+		Expect(diffs[1].Diff).To(HavePrefix("--- a/resmgmt/openstack-absent-metric-alert-rules\n+++ b/resmgmt/openstack-absent-metric-alert-rules\n"))
+		Expect(diffs[1].Diff).To(ContainSubstring("-    - alert: AbsentFoo\n"))
+		Expect(diffs[1].Diff).To(ContainSubstring("+    - alert: AbsentLimesFoo\n"))
+		Expect(diffs[1].Diff).To(ContainSubstring("-  - name: openstack-limes-roleassign.alerts/foo.alerts\n"))
+
+		Expect(*writes).To(BeEmpty())
+	})
+
+	It("takes the scope and unparsable PrometheusRules into account", func() {
+		broken := promRule.DeepCopy()
+		broken.Name = "openstack-limes-roleassign.alerts"
+		broken.Spec.Groups[0].Rules[0].Expr = intstr.FromString("limes_foo >")
+		c, _ := newFakeClient(scheme,
+			namespace.DeepCopy(),
+			promRule.DeepCopy(),
+			broken,
+			absencePromRule("openstack-absent-metric-alert-rules", "openstack-limes-api.alerts", "openstack-limes-roleassign.alerts"),
+		)
+
+		// The absence alert rules of a PrometheusRule that can not be parsed are left
+		// as is.
+		r := newReconciler()
+		diffs, err := r.Diff(ctx, c)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diffs).To(HaveLen(1))
+		Expect(diffs[0].Diff).To(ContainSubstring("+    - alert: AbsentLimesFoo\n"))
+		Expect(diffs[0].Diff).ToNot(ContainSubstring("-  - name: openstack-limes-roleassign.alerts/foo.alerts\n"))
+
+		// The absence alert rules of PrometheusRules that are out of scope are removed.
+		r.Scope.NamespaceSelector = labels.SelectorFromSet(labels.Set{"team": "resmgmt"})
+		diffs, err = r.Diff(ctx, c)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diffs).To(HaveLen(1))
+		Expect(diffs[0].Diff).To(HavePrefix("--- a/resmgmt/openstack-absent-metric-alert-rules\n+++ /dev/null\n"))
+	})
+})
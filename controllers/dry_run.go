@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// dryRunConfigMapMaxSize is the maximum total size of the values in the DryRunConfigMap.
+// It is well below the size limit of 1 MiB for ConfigMaps so that there is enough room
+// for the keys and the metadata.
+const dryRunConfigMapMaxSize = 768 * 1024
+
+// DryRunConfigMapKey returns the key in the DryRunConfigMap for the given
+// AbsencePrometheusRule. The underscore can not be part of a namespace or a name.
+func DryRunConfigMapKey(absencePromRule types.NamespacedName) string {
+	return absencePromRule.Namespace + "_" + absencePromRule.Name + ".yaml"
+}
+
+// recordDryRun is used instead of writing an AbsencePrometheusRule if r.DryRun is true.
+// It logs the operation and records it in the DryRunConfigMap, if any, together with
+// the fields of the AbsencePrometheusRule that would have been applied.
+//
+// The DryRunConfigMap holds one entry per AbsencePrometheusRule which is overwritten by
+// each operation. If the entries would exceed dryRunConfigMapMaxSize then the oldest
+// ones are evicted.
+//
+// The operation is also passed to r.dryRunRecorder, if any. Only its error is returned.
+func (r *PrometheusRuleReconciler) recordDryRun(ctx context.Context, operation string, absencePromRule *monitoringv1.PrometheusRule) error {
+	key := client.ObjectKeyFromObject(absencePromRule)
+	r.Log.Info("dry run: skipped operation on AbsencePrometheusRule",
+		"operation", operation, "AbsencePrometheusRule", key.String(), "absenceRules", countRules(absencePromRule.Spec.Groups))
+	if r.DryRunConfigMap.Name != "" {
+		// We choose to absorb the errors here since the ConfigMap is only informational.
+		err := r.writeDryRunConfigMap(ctx, operation, absencePromRule)
+		if err != nil {
+			r.Log.Error(err, "could not record dry run in ConfigMap",
+				"name", r.DryRunConfigMap.Name, "namespace", r.DryRunConfigMap.Namespace)
+		}
+	}
+	if r.dryRunRecorder == nil {
+		return nil
+	}
+	return r.dryRunRecorder(ctx, operation, absencePromRule)
+}
+
+func (r *PrometheusRuleReconciler) writeDryRunConfigMap(ctx context.Context, operation string, absencePromRule *monitoringv1.PrometheusRule) error {
+	obj, err := appliedAbsencePrometheusRule(absencePromRule, r.Scope.copiedLabels())
+	if err != nil {
+		return err
+	}
+	buf, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return err
+	}
+	header := fmt.Sprintf("# %s %s\n", operation, time.Now().UTC().Format(time.RFC3339))
+	value := header + string(buf)
+	if len(value) > dryRunConfigMapMaxSize {
+		value = header + "# The AbsencePrometheusRule is omitted since it exceeds the size limit of the ConfigMap.\n"
+	}
+	key := DryRunConfigMapKey(client.ObjectKeyFromObject(absencePromRule))
+
+	// The ConfigMap is usually not in the cache, see main.go.
+	var reader client.Reader = r.Client
+	if r.APIReader != nil {
+		reader = r.APIReader
+	}
+	var cm corev1.ConfigMap
+	err = reader.Get(ctx, r.DryRunConfigMap, &cm)
+	if apierrors.IsNotFound(err) {
+		cm = corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: r.DryRunConfigMap.Namespace, Name: r.DryRunConfigMap.Name},
+			Data:       map[string]string{key: value},
+		}
+		return r.Create(ctx, &cm)
+	}
+	if err != nil {
+		return err
+	}
+
+	// A merge patch only replaces the given keys, so that concurrent reconciliations of
+	// different AbsencePrometheusRules don't overwrite each other. A null value removes
+	// the key.
+	data := map[string]*string{key: &value}
+	for _, k := range evictDryRunEntries(cm.Data, key, len(value)) {
+		data[k] = nil
+	}
+	patch, err := json.Marshal(map[string]any{"data": data})
+	if err != nil {
+		return err
+	}
+	return r.Patch(ctx, &cm, client.RawPatch(types.MergePatchType, patch))
+}
+
+// evictDryRunEntries returns the keys of the oldest entries in the given DryRunConfigMap
+// data that have to be removed so that the total size of the values does not exceed
+// dryRunConfigMapMaxSize once the value for the given key has been replaced by one of
+// the given size. Entries whose age can not be determined are evicted first.
+func evictDryRunEntries(data map[string]string, key string, size int) []string {
+	type entry struct {
+		key  string
+		time time.Time
+		size int
+	}
+	total := size
+	entries := make([]entry, 0, len(data))
+	for k, v := range data {
+		if k == key {
+			continue
+		}
+		total += len(v)
+		entries = append(entries, entry{k, dryRunEntryTime(v), len(v)})
+	}
+	slices.SortFunc(entries, func(a, b entry) int {
+		return cmp.Or(a.time.Compare(b.time), cmp.Compare(a.key, b.key))
+	})
+
+	var result []string
+	for _, e := range entries {
+		if total <= dryRunConfigMapMaxSize {
+			break
+		}
+		result = append(result, e.key)
+		total -= e.size
+	}
+	return result
+}
+
+// dryRunEntryTime returns the time from the header of an entry in the DryRunConfigMap,
+// i.e. from its first line "# <operation> <time>". The zero time is returned if the
+// header can not be parsed.
+func dryRunEntryTime(value string) time.Time {
+	header, _, _ := strings.Cut(value, "\n")
+	fields := strings.Fields(header)
+	if len(fields) != 3 || fields[0] != "#" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, fields[2])
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
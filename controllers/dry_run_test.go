@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+var _ = Describe("Dry run", func() {
+	logger := zap.New(zap.UseDevMode(true))
+	ctx := context.Background()
+	scheme := newTestScheme()
+
+	promRule := func() *monitoringv1.PrometheusRule {
+		return &monitoringv1.PrometheusRule{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "resmgmt",
+				Name:      "openstack-limes-api.alerts",
+				Labels:    map[string]string{"prometheus": "openstack"},
+			},
+			Spec: monitoringv1.PrometheusRuleSpec{Groups: []monitoringv1.RuleGroup{{
+				Name:  "foo.alerts",
+				Rules: []monitoringv1.Rule{{Alert: "LimesFoo", Expr: intstr.FromString("limes_foo > 0")}},
+			}}},
+		}
+	}
+	newReconciler := func(c client.Client) *PrometheusRuleReconciler {
+		nameGen, err := CreateAbsencePromRuleNameGenerator(DefaultAbsencePromRuleNameTemplate)
+		Expect(err).ToNot(HaveOccurred())
+		return &PrometheusRuleReconciler{
+			Client:             c,
+			Scheme:             scheme,
+			Log:                logger,
+			PrometheusRuleName: nameGen,
+			UseFinalizer:       true,
+			DryRun:             true,
+		}
+	}
+	absencePromRuleKey := types.NamespacedName{Namespace: "resmgmt", Name: "openstack-absent-metric-alert-rules"}
+	dryRunConfigMapKey := types.NamespacedName{Namespace: "kube-monitoring", Name: "absent-metrics-operator-dry-run"}
+	dryRunConfigMap := func(data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: dryRunConfigMapKey.Namespace, Name: dryRunConfigMapKey.Name},
+			Data:       data,
+		}
+	}
+
+	It("does not write anything", func() {
+		c, writes := newFakeClient(scheme, promRule())
+		r := newReconciler(c)
+		pr := promRule()
+		Expect(r.reconcileObject(ctx, client.ObjectKeyFromObject(pr), pr)).To(Succeed())
+		Expect(*writes).To(BeEmpty())
+
+		var actual monitoringv1.PrometheusRule
+		Expect(c.Get(ctx, client.ObjectKeyFromObject(pr), &actual)).To(Succeed())
+		Expect(actual.Finalizers).To(BeEmpty())
+		Expect(actual.Annotations).To(BeEmpty())
+	})
+
+	It("records the operations in a ConfigMap", func() {
+		c, writes := newFakeClient(scheme, promRule())
+		r := newReconciler(c)
+		r.DryRunConfigMap = dryRunConfigMapKey
+		pr := promRule()
+		Expect(r.reconcileObject(ctx, client.ObjectKeyFromObject(pr), pr)).To(Succeed())
+		Expect(*writes).To(Equal([]string{"create *v1.ConfigMap " + dryRunConfigMapKey.String()}))
+
+		var cm corev1.ConfigMap
+		Expect(c.Get(ctx, dryRunConfigMapKey, &cm)).To(Succeed())
+		Expect(cm.Data).To(HaveLen(1))
+		value := cm.Data[DryRunConfigMapKey(absencePromRuleKey)]
+		Expect(value).To(MatchRegexp(`^# create \d{4}-\d\d-\d\dT\d\d:\d\d:\d\dZ\n`))
+		Expect(value).To(ContainSubstring("name: openstack-absent-metric-alert-rules\n"))
+		Expect(value).To(ContainSubstring("expr: absent(limes_foo)\n"))
+
+		// Other keys are retained when the ConfigMap is updated.
+		cm.Data["other"] = "foo"
+		Expect(c.Update(ctx, &cm)).To(Succeed())
+		absencePromRule := &monitoringv1.PrometheusRule{ObjectMeta: metav1.ObjectMeta{
+			Namespace: absencePromRuleKey.Namespace,
+			Name:      absencePromRuleKey.Name,
+		}}
+		*writes = nil
+		Expect(r.deleteAbsencePrometheusRule(ctx, absencePromRule)).To(Succeed())
+		Expect(*writes).To(Equal([]string{"patch *v1.ConfigMap " + dryRunConfigMapKey.String()}))
+		Expect(c.Get(ctx, dryRunConfigMapKey, &cm)).To(Succeed())
+		Expect(cm.Data).To(HaveKeyWithValue("other", "foo"))
+		Expect(cm.Data[DryRunConfigMapKey(absencePromRuleKey)]).To(HavePrefix("# delete "))
+	})
+
+	It("evicts the oldest entries from the ConfigMap", func() {
+		entry := func(t string, size int) string {
+			header := "# patch " + t + "\n"
+			return header + strings.Repeat("x", size-len(header))
+		}
+		third := dryRunConfigMapMaxSize / 3
+		c, _ := newFakeClient(scheme, dryRunConfigMap(map[string]string{
+			"resmgmt_a.yaml": entry("2025-01-01T00:00:02Z", third),
+			"resmgmt_b.yaml": entry("2025-01-01T00:00:01Z", third),
+			"resmgmt_c.yaml": entry("2025-01-01T00:00:03Z", third),
+		}))
+		r := newReconciler(c)
+		r.DryRunConfigMap = dryRunConfigMapKey
+		absencePromRule := &monitoringv1.PrometheusRule{ObjectMeta: metav1.ObjectMeta{
+			Namespace: absencePromRuleKey.Namespace,
+			Name:      absencePromRuleKey.Name,
+		}}
+		Expect(r.deleteAbsencePrometheusRule(ctx, absencePromRule)).To(Succeed())
+
+		// The merge patch removes the evicted entries.
+		var cm corev1.ConfigMap
+		Expect(c.Get(ctx, dryRunConfigMapKey, &cm)).To(Succeed())
+		Expect(cm.Data).To(HaveLen(3))
+		Expect(cm.Data).ToNot(HaveKey("resmgmt_b.yaml"))
+		Expect(cm.Data).To(HaveKey(DryRunConfigMapKey(absencePromRuleKey)))
+
+		// Overwriting an entry does not evict anything.
+		Expect(evictDryRunEntries(cm.Data, "resmgmt_a.yaml", third)).To(BeEmpty())
+		// Entries whose age can not be determined are evicted first.
+		cm.Data["other"] = strings.Repeat("x", third)
+		Expect(evictDryRunEntries(cm.Data, "resmgmt_new.yaml", third)).To(Equal([]string{"other", "resmgmt_a.yaml"}))
+	})
+})
@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// These are the reasons of the events that are emitted by the operator.
+const (
+	eventReasonCreated            = "Created"
+	eventReasonUpdated            = "Updated"
+	eventReasonDeleted            = "Deleted"
+	eventReasonParseError         = "ParseError"
+	eventReasonNameTemplateError  = "NameTemplateError"
+	eventReasonInvalidPolicy      = "InvalidPolicy"
+	eventReasonUnresolvedSelector = "UnresolvedSelector"
+	eventReasonFieldConflict      = "FieldConflict"
+)
+
+// eventDedupInterval is the interval during which identical Warning events for the same
+// object are only emitted once. Without it, a broken alert rule would result in a new
+// event every requeueInterval.
+var eventDedupInterval = 1 * time.Hour
+
+type eventKey struct {
+	uid     types.UID
+	reason  string
+	message string
+}
+
+// eventCache remembers when Warning events were last emitted.
+type eventCache struct {
+	mu       sync.Mutex
+	lastSeen map[eventKey]time.Time
+}
+
+// shouldEmit returns true if the event with the given key was not emitted within the
+// eventDedupInterval and records it as emitted.
+func (c *eventCache) shouldEmit(key eventKey, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lastSeen == nil {
+		c.lastSeen = make(map[eventKey]time.Time)
+	}
+	for k, t := range c.lastSeen {
+		if now.Sub(t) >= eventDedupInterval {
+			delete(c.lastSeen, k)
+		}
+	}
+	if _, ok := c.lastSeen[key]; ok {
+		return false
+	}
+	c.lastSeen[key] = now
+	return true
+}
+
+// recordEvent emits an event for the given object. Identical Warning events are
+// deduplicated, see eventDedupInterval. No events are emitted if r.DryRun is true.
+func (r *PrometheusRuleReconciler) recordEvent(obj client.Object, eventType, reason, messageFmt string, args ...any) {
+	if r.Recorder == nil || r.DryRun {
+		return
+	}
+	msg := fmt.Sprintf(messageFmt, args...)
+	if eventType == corev1.EventTypeWarning &&
+		!r.eventCache.shouldEmit(eventKey{uid: obj.GetUID(), reason: reason, message: msg}, time.Now()) {
+		return
+	}
+	r.Recorder.Event(obj, eventType, reason, msg)
+}
@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+var _ = Describe("Events", func() {
+	promRule := &monitoringv1.PrometheusRule{ObjectMeta: metav1.ObjectMeta{
+		Name:      "openstack-limes-api.alerts",
+		Namespace: "resmgmt",
+		UID:       "8a4c2f5e-6f2a-4b8e-9d6c-3b1f0e7a9c21",
+	}}
+	otherPromRule := promRule.DeepCopy()
+	otherPromRule.UID = "0d9e3b7a-1c4f-4e2b-8a6d-5f2c9b1e7d43"
+
+	It("deduplicates Warning events", func() {
+		recorder := record.NewFakeRecorder(10)
+		r := &PrometheusRuleReconciler{Recorder: recorder}
+
+		r.recordEvent(promRule, corev1.EventTypeWarning, eventReasonParseError, "Could not generate absence alert rules: %s", "boom")
+		r.recordEvent(promRule, corev1.EventTypeWarning, eventReasonParseError, "Could not generate absence alert rules: %s", "boom")
+		r.recordEvent(promRule, corev1.EventTypeWarning, eventReasonParseError, "Could not generate absence alert rules: %s", "bang")
+		r.recordEvent(otherPromRule, corev1.EventTypeWarning, eventReasonParseError, "Could not generate absence alert rules: %s", "boom")
+		r.recordEvent(promRule, corev1.EventTypeNormal, eventReasonUpdated, "Updated")
+		r.recordEvent(promRule, corev1.EventTypeNormal, eventReasonUpdated, "Updated")
+		close(recorder.Events)
+
+		var events []string
+		for e := range recorder.Events {
+			events = append(events, e)
+		}
+		Expect(events).To(Equal([]string{
+			"Warning ParseError Could not generate absence alert rules: boom",
+			"Warning ParseError Could not generate absence alert rules: bang",
+			"Warning ParseError Could not generate absence alert rules: boom",
+			"Normal Updated Updated",
+			"Normal Updated Updated",
+		}))
+	})
+
+	It("emits a Warning event again after the dedup interval", func() {
+		var c eventCache
+		key := eventKey{uid: promRule.UID, reason: eventReasonParseError, message: "boom"}
+		now := metav1.Now().Time
+		Expect(c.shouldEmit(key, now)).To(BeTrue())
+		Expect(c.shouldEmit(key, now.Add(eventDedupInterval/2))).To(BeFalse())
+		Expect(c.shouldEmit(key, now.Add(eventDedupInterval))).To(BeTrue())
+		Expect(c.lastSeen).To(HaveLen(1))
+	})
+
+	It("uses the reason of a ruleGroupParseError", func() {
+		Expect((&ruleGroupParseError{cause: errors.New("boom")}).eventReason()).To(Equal(eventReasonParseError))
+		Expect((&ruleGroupParseError{cause: errors.New("boom"), reason: eventReasonNameTemplateError}).eventReason()).
+			To(Equal(eventReasonNameTemplateError))
+	})
+})
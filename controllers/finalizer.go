@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/sapcc/go-bits/errext"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// finalizerCleanup is added to PrometheusRules if the reconciler's UseFinalizer is true.
+// It makes sure that the absence alert rules of a PrometheusRule are removed from the
+// corresponding AbsencePrometheusRule before the PrometheusRule is deleted.
+const finalizerCleanup = "absent-metrics-operator/cleanup"
+
+// updateFinalizer adds the finalizerCleanup to the PrometheusRule or removes it from it.
+// It does nothing if r.DryRun is true.
+func (r *PrometheusRuleReconciler) updateFinalizer(ctx context.Context, promRule *monitoringv1.PrometheusRule, add bool) error {
+	if r.DryRun {
+		return nil
+	}
+	return updateFinalizer(ctx, r.Client, promRule, add)
+}
+
+func updateFinalizer(ctx context.Context, c client.Client, promRule *monitoringv1.PrometheusRule, add bool) error {
+	if controllerutil.ContainsFinalizer(promRule, finalizerCleanup) == add {
+		return nil
+	}
+	unmodified := promRule.DeepCopy()
+	if add {
+		controllerutil.AddFinalizer(promRule, finalizerCleanup)
+	} else {
+		controllerutil.RemoveFinalizer(promRule, finalizerCleanup)
+	}
+	// The optimistic lock ensures that we don't overwrite finalizers that were added by
+	// someone else in the meantime.
+	return c.Patch(ctx, promRule, client.MergeFromWithOptions(unmodified, client.MergeFromWithOptimisticLock{}))
+}
+
+// finalizePrometheusRule removes the absence alert rules of a PrometheusRule that is
+// being deleted from the corresponding AbsencePrometheusRule and then removes the
+// finalizerCleanup so that the deletion can proceed.
+//
+// Unlike handleObjectNotFound, errors are not absorbed here. The PrometheusRule is
+// requeued until its absence alert rules have been cleaned up.
+func (r *PrometheusRuleReconciler) finalizePrometheusRule(
+	ctx context.Context,
+	key types.NamespacedName,
+	promRule *monitoringv1.PrometheusRule,
+) error {
+
+	if !controllerutil.ContainsFinalizer(promRule, finalizerCleanup) {
+		// The absence alert rules will be cleaned up by handleObjectNotFound once the
+		// PrometheusRule is gone.
+		return nil
+	}
+
+	// If the name of the corresponding AbsencePrometheusRule can not be determined, e.g.
+	// because of an invalid policy, then cleanUpOrphanedAbsenceAlertRules will look for
+	// it in all AbsencePrometheusRules in the namespace.
+	var aPRName string
+	p, err := r.listPolicies(ctx, key.Namespace)
+	switch _, isParseErr := errext.As[*ruleGroupParseError](err); {
+	case err == nil:
+		if cfg, err := r.promRuleConfig(ctx, p, promRule); err == nil && !cfg.disabled {
+			aPRName, _ = cfg.prometheusRuleName.Generate(promRule)
+		}
+	case !isParseErr:
+		return err
+	}
+	err = r.cleanUpOrphanedAbsenceAlertRules(ctx, key, aPRName)
+	if err != nil && !apierrors.IsNotFound(err) && !errors.Is(err, errCorrespondingAbsencePromRuleNotExists) {
+		return err
+	}
+	r.Log.V(logLevelDebug).Info("successfully cleaned up absence alert rules of deleted PrometheusRule",
+		"name", key.Name, "namespace", key.Namespace)
+
+	deletePrometheusRuleMetrics(key)
+	return r.updateFinalizer(ctx, promRule, false)
+}
+
+// RemoveFinalizers removes the finalizer that is added by the operator from all
+// PrometheusRules in the cluster. It returns the number of PrometheusRules that were
+// updated.
+//
+// This is used when the operator is uninstalled after having been run with finalizers,
+// since otherwise PrometheusRules could not be deleted anymore.
+func RemoveFinalizers(ctx context.Context, c client.Client) (int, error) {
+	var promRules monitoringv1.PrometheusRuleList
+	if err := c.List(ctx, &promRules); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, pr := range promRules.Items {
+		if !controllerutil.ContainsFinalizer(&pr, finalizerCleanup) {
+			continue
+		}
+		if err := updateFinalizer(ctx, c, &pr, false); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// GenerateAbsencePrometheusRules generates the AbsencePrometheusRules for the given
+// PrometheusRules without a cluster, e.g. to review the absence alert rules for
+// PrometheusRule manifests before they are deployed. The result is sorted by namespace
+// and name.
+//
+// The absence alert rules are generated in the same way as by the operator except that
+// policies, the Scope and the Mode are not taken into account since they depend on the
+// cluster. PrometheusRules that have the 'absent-metrics-operator/disable' label and
+// AbsencePrometheusRules are skipped. The 'absent-metrics-operator/updated-at'
+// annotation and owner references are not set.
+func GenerateAbsencePrometheusRules(
+	logger logr.Logger,
+	promRules []monitoringv1.PrometheusRule,
+	nameGen *AbsencePromRuleNameGenerator,
+	opts RuleOptions,
+	aggregateSourceAlerts bool,
+) ([]monitoringv1.PrometheusRule, error) {
+
+	type absencePromRule struct {
+		obj     *monitoringv1.PrometheusRule
+		sources ruleGroupSources
+	}
+	absencePromRules := make(map[types.NamespacedName]*absencePromRule)
+	for _, promRule := range promRules {
+		if parseBool(promRule.Labels[labelOperatorManagedBy]) || parseBool(promRule.Labels[labelOperatorDisable]) {
+			continue
+		}
+
+		promRuleOpts, err := opts.WithAnnotations(promRule.GetAnnotations())
+		if err != nil {
+			return nil, fmt.Errorf("PrometheusRule %s/%s: %w", promRule.Namespace, promRule.Name, err)
+		}
+		promRuleOpts.PrometheusRule = promRule.ObjectMeta
+		absenceRuleGroups, err := ParseRuleGroups(logger, promRule.Spec.Groups, promRule.Name, promRuleOpts)
+		if err != nil {
+			return nil, fmt.Errorf("PrometheusRule %s/%s: %w", promRule.Namespace, promRule.Name, err)
+		}
+		if len(absenceRuleGroups) == 0 {
+			continue
+		}
+
+		name, err := nameGen.Generate(&promRule)
+		if err != nil {
+			return nil, fmt.Errorf("PrometheusRule %s/%s: %w", promRule.Namespace, promRule.Name, err)
+		}
+		key := types.NamespacedName{Namespace: promRule.Namespace, Name: name}
+		aPR, ok := absencePromRules[key]
+		if !ok {
+			aPR = &absencePromRule{
+				obj:     newAbsencePrometheusRule(name, promRule.Namespace, promRule.Labels),
+				sources: make(ruleGroupSources),
+			}
+			absencePromRules[key] = aPR
+		}
+		aPR.obj.Spec.Groups = mergeAbsenceRuleGroups(promRule.Name, aPR.sources, aPR.obj.Spec.Groups, absenceRuleGroups)
+		aPR.sources.add(&promRule, absenceRuleGroups)
+	}
+
+	r := &PrometheusRuleReconciler{AggregateSourceAlerts: aggregateSourceAlerts}
+	result := make([]monitoringv1.PrometheusRule, 0, len(absencePromRules))
+	for _, aPR := range absencePromRules {
+		obj := aPR.obj
+		obj.SetGroupVersionKind(monitoringv1.SchemeGroupVersion.WithKind(monitoringv1.PrometheusRuleKind))
+		obj.Spec.Groups = r.aggregateSourceAlerts(obj.Spec.Groups, aPR.sources)
+		sortRuleGroups(obj)
+		setRuleGroupSources(obj, aPR.sources)
+		result = append(result, *obj)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
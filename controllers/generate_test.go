@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+var _ = Describe("Offline generation", func() {
+	logger := zap.New(zap.UseDevMode(true))
+	promRule := func(namespace, name string, l map[string]string, metrics ...string) monitoringv1.PrometheusRule {
+		rules := make([]monitoringv1.Rule, 0, len(metrics))
+		for _, m := range metrics {
+			rules = append(rules, monitoringv1.Rule{Alert: "Alert" + m, Expr: intstr.FromString(m + " > 0")})
+		}
+		return monitoringv1.PrometheusRule{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: l},
+			Spec:       monitoringv1.PrometheusRuleSpec{Groups: []monitoringv1.RuleGroup{{Name: "foo.alerts", Rules: rules}}},
+		}
+	}
+
+	It("generates the AbsencePrometheusRules for PrometheusRule manifests", func() {
+		nameGen, err := CreateAbsencePromRuleNameGenerator(DefaultAbsencePromRuleNameTemplate)
+		Expect(err).ToNot(HaveOccurred())
+		openstack := map[string]string{"prometheus": "openstack"}
+		promRules := []monitoringv1.PrometheusRule{
+			promRule("swift", "openstack-swift.alerts", openstack, "swift_foo"),
+			promRule("resmgmt", "openstack-limes-api.alerts", openstack, "limes_foo"),
+			promRule("resmgmt", "openstack-limes-roleassign.alerts", openstack, "limes_foo", "limes_bar"),
+			promRule("resmgmt", "kubernetes-keppel.alerts", map[string]string{labelOperatorDisable: "true"}, "keppel_foo"),
+			promRule("resmgmt", "openstack-absent-metric-alert-rules", map[string]string{labelOperatorManagedBy: "true"}, "limes_baz"),
+		}
+
+		actual, err := GenerateAbsencePrometheusRules(logger, promRules, nameGen, RuleOptions{}, true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(HaveLen(2))
+		Expect(actual[0].Namespace).To(Equal("resmgmt"))
+		Expect(actual[0].Name).To(Equal("openstack-absent-metric-alert-rules"))
+		Expect(actual[0].Kind).To(Equal(monitoringv1.PrometheusRuleKind))
+		Expect(actual[0].Labels).To(HaveKeyWithValue("prometheus", "openstack"))
+		Expect(actual[0].Annotations).ToNot(HaveKey(annotationOperatorUpdatedAt))
+		Expect(actual[0].Annotations).To(HaveKeyWithValue(annotationRuleGroupSources,
+			`{"openstack-limes-api.alerts/foo.alerts":{"name":"openstack-limes-api.alerts"},`+
+				`"openstack-limes-roleassign.alerts/foo.alerts":{"name":"openstack-limes-roleassign.alerts"}}`))
+
+		groups := actual[0].Spec.Groups
+		Expect(groups).To(HaveLen(2))
+		Expect(groups[0].Name).To(Equal("openstack-limes-api.alerts/foo.alerts"))
+		Expect(groups[0].Rules[0].Annotations).To(HaveKeyWithValue(annotationAllSourceAlerts,
+			`["openstack-limes-api.alerts/Alertlimes_foo","openstack-limes-roleassign.alerts/Alertlimes_foo"]`))
+		Expect(groups[1].Name).To(Equal("openstack-limes-roleassign.alerts/foo.alerts"))
+		Expect(groups[1].Rules).To(HaveLen(2))
+
+		Expect(actual[1].Namespace).To(Equal("swift"))
+		Expect(actual[1].Name).To(Equal("openstack-absent-metric-alert-rules"))
+	})
+
+	It("reports the PrometheusRule that could not be parsed", func() {
+		nameGen, err := CreateAbsencePromRuleNameGenerator("{{ .metadata.labels.missing }}")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = GenerateAbsencePrometheusRules(logger, []monitoringv1.PrometheusRule{
+			promRule("resmgmt", "openstack-limes-api.alerts", nil, "limes_foo"),
+		}, nameGen, RuleOptions{}, false)
+		Expect(err).To(MatchError(ContainSubstring("PrometheusRule resmgmt/openstack-limes-api.alerts")))
+	})
+})
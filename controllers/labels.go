@@ -12,11 +12,34 @@ const (
 
 const (
 	annotationOperatorUpdatedAt = "absent-metrics-operator/updated-at"
+	annotationKeepLabelMatchers = "absent-metrics-operator/keep-label-matchers"
+	annotationAbsenceMode       = "absent-metrics-operator/absence-mode"
+	annotationAbsenceRange      = "absent-metrics-operator/absence-range"
+	annotationAbsenceFor        = "absent-metrics-operator/absence-for"
+	annotationAbsenceForPolicy  = "absent-metrics-operator/absence-for-policy"
+	annotationRuleGroupSources  = "absent-metrics-operator/rule-group-sources"
+	annotationManualOverride    = "absent-metrics-operator/manual-override"
+
+	// These annotations are written to a PrometheusRule to report the result of its
+	// reconciliation.
+	annotationStatusPrefix          = "status.absent-metrics-operator/"
+	annotationStatusAbsencePromRule = annotationStatusPrefix + "absence-prometheusrule"
+	annotationStatusAbsenceRules    = annotationStatusPrefix + "absence-rules"
+	annotationStatusLastSuccess     = annotationStatusPrefix + "last-success"
+	annotationStatusError           = annotationStatusPrefix + "error"
+
+	// These annotations are set on the absence alert rules themselves, therefore they
+	// must be valid Prometheus annotation names.
+	annotationSourceSeverity  = "source_severity"
+	annotationSourceAlerts    = "source_alerts"
+	annotationAllSourceAlerts = "all_source_alerts"
 
 	labelOperatorManagedBy = "absent-metrics-operator/managed-by"
 	labelOperatorDisable   = "absent-metrics-operator/disable"
+	labelOperatorEnable    = "absent-metrics-operator/enable"
 
 	labelNoAlertOnAbsence = "no_alert_on_absence"
+	labelSeverity         = "severity"
 	labelPrometheusServer = "prometheus"
 	labelGreenhousePlugin = "plugin"
 	labelThanosRuler      = "thanos-ruler"
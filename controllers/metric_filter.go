@@ -0,0 +1,214 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// These are the keys in the metric name filter ConfigMap that hold the newline-separated
+// lists of metric name patterns.
+const (
+	MetricNameFilterSkipKey = "skip-metrics"
+	MetricNameFilterOnlyKey = "only-metrics"
+)
+
+// MetricNameFilter decides whether absence alert rules are generated for a metric.
+//
+// A metric is skipped if its name matches any of the skip patterns (deny list). If
+// there are any only patterns (allow list) then a metric is also skipped if its name
+// does not match any of them.
+//
+// A nil *MetricNameFilter allows all metric names.
+type MetricNameFilter struct {
+	skip []*regexp.Regexp
+	only []*regexp.Regexp
+}
+
+// NewMetricNameFilter creates a MetricNameFilter from lists of skip and only patterns.
+//
+// A pattern is either a glob where '*' matches any sequence of characters and '?'
+// matches a single character, e.g. 'limes_*_errors_total', or a regex enclosed in
+// slashes, e.g. '/limes_(foo|bar)_total/'. Patterns always match the entire metric name.
+func NewMetricNameFilter(skip, only []string) (*MetricNameFilter, error) {
+	var (
+		f   MetricNameFilter
+		err error
+	)
+	f.skip, err = compileMetricNamePatterns(skip)
+	if err != nil {
+		return nil, err
+	}
+	f.only, err = compileMetricNamePatterns(only)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func compileMetricNamePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	result := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		var rxStr string
+		if len(p) > 1 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") {
+			rxStr = p[1 : len(p)-1]
+		} else {
+			rxStr = regexp.QuoteMeta(p)
+			rxStr = strings.ReplaceAll(rxStr, `\*`, ".*")
+			rxStr = strings.ReplaceAll(rxStr, `\?`, ".")
+		}
+		rx, err := regexp.Compile("^(?:" + rxStr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid metric name pattern %q: %w", p, err)
+		}
+		result = append(result, rx)
+	}
+	return result, nil
+}
+
+// Allows returns true if absence alert rules should be generated for the given metric
+// name.
+func (f *MetricNameFilter) Allows(name string) bool {
+	if f == nil {
+		return true
+	}
+	for _, rx := range f.skip {
+		if rx.MatchString(name) {
+			return false
+		}
+	}
+	if len(f.only) == 0 {
+		return true
+	}
+	for _, rx := range f.only {
+		if rx.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// merge returns a new MetricNameFilter that uses the patterns of both filters.
+func (f *MetricNameFilter) merge(other *MetricNameFilter) *MetricNameFilter {
+	switch {
+	case f == nil:
+		return other
+	case other == nil:
+		return f
+	}
+	var result MetricNameFilter
+	result.skip = append(append(result.skip, f.skip...), other.skip...)
+	result.only = append(append(result.only, f.only...), other.only...)
+	return &result
+}
+
+// splitMetricNamePatterns splits a newline-separated list of patterns. Empty lines and
+// lines starting with '#' are ignored.
+func splitMetricNamePatterns(in string) []string {
+	var result []string
+	scanner := bufio.NewScanner(strings.NewReader(in))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		result = append(result, line)
+	}
+	return result
+}
+
+// metricNameFilterCache holds the last successfully loaded metric name filter
+// ConfigMap so that it only has to be parsed when it changes.
+type metricNameFilterCache struct {
+	mu              sync.Mutex
+	resourceVersion string
+	filter          *MetricNameFilter
+}
+
+// metricNameFilter returns the active MetricNameFilter. This is the filter that was
+// provided via flags combined with the patterns from the metric name filter ConfigMap,
+// if one was configured.
+//
+// The ConfigMap is read from the cache on every call therefore changes to it take
+// effect without restarting the operator. If the ConfigMap contains invalid patterns
+// then the last valid version of it continues to be used.
+func (r *PrometheusRuleReconciler) metricNameFilter(ctx context.Context) (*MetricNameFilter, error) {
+	if r.MetricNameFilterConfigMap.Name == "" {
+		return r.RuleOptions.MetricNameFilter, nil
+	}
+
+	var cm corev1.ConfigMap
+	err := r.Get(ctx, r.MetricNameFilterConfigMap, &cm)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return r.RuleOptions.MetricNameFilter, nil
+		}
+		return nil, err
+	}
+
+	c := &r.metricNameFilterCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cm.ResourceVersion != c.resourceVersion {
+		f, err := NewMetricNameFilter(
+			splitMetricNamePatterns(cm.Data[MetricNameFilterSkipKey]),
+			splitMetricNamePatterns(cm.Data[MetricNameFilterOnlyKey]),
+		)
+		if err != nil {
+			r.Log.Error(err, "could not load metric name filter ConfigMap, using the last valid version",
+				"name", cm.Name, "namespace", cm.Namespace)
+		} else {
+			c.filter = f
+		}
+		c.resourceVersion = cm.ResourceVersion
+	}
+	return r.RuleOptions.MetricNameFilter.merge(c.filter), nil
+}
+
+// isMetricNameFilterConfigMap is used as a predicate to only watch the metric name
+// filter ConfigMap.
+func (r *PrometheusRuleReconciler) isMetricNameFilterConfigMap(obj client.Object) bool {
+	return obj.GetNamespace() == r.MetricNameFilterConfigMap.Namespace &&
+		obj.GetName() == r.MetricNameFilterConfigMap.Name
+}
+
+// enqueueAllPrometheusRules returns reconcile requests for all PrometheusRules, except
+// AbsencePrometheusRules. It is used when a change in configuration affects all of
+// them.
+func (r *PrometheusRuleReconciler) enqueueAllPrometheusRules(ctx context.Context, _ client.Object) []reconcile.Request {
+	return r.enqueuePrometheusRules(ctx)
+}
+
+func (r *PrometheusRuleReconciler) enqueuePrometheusRules(ctx context.Context, opts ...client.ListOption) []reconcile.Request {
+	var promRules monitoringv1.PrometheusRuleList
+	if err := r.List(ctx, &promRules, opts...); err != nil {
+		r.Log.Error(err, "could not list PrometheusRules")
+		return nil
+	}
+
+	result := make([]reconcile.Request, 0, len(promRules.Items))
+	for _, pr := range promRules.Items {
+		if parseBool(pr.Labels[labelOperatorManagedBy]) {
+			continue
+		}
+		result = append(result, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&pr)})
+	}
+	return result
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MetricNameFilter", func() {
+	DescribeTable("Filtering metric names",
+		func(skip, only []string, allowed, skipped []string) {
+			f, err := NewMetricNameFilter(skip, only)
+			Expect(err).ToNot(HaveOccurred())
+			for _, name := range allowed {
+				Expect(f.Allows(name)).To(BeTrue(), "expected %q to be allowed", name)
+			}
+			for _, name := range skipped {
+				Expect(f.Allows(name)).To(BeFalse(), "expected %q to be skipped", name)
+			}
+		},
+		Entry("empty filter",
+			nil, nil,
+			[]string{"ALERTS", "limes_failed_scrapes"},
+			nil,
+		),
+		Entry("skip list with literal names and globs",
+			[]string{"ALERTS", "limes_*_errors_total", "swift_?"},
+			nil,
+			[]string{"ALERTS_FOR_STATE", "limes_errors_total", "swift_ab"},
+			[]string{"ALERTS", "limes_api_errors_total", "swift_a"},
+		),
+		Entry("skip list with regex",
+			[]string{"/limes_(foo|bar)_total/"},
+			nil,
+			[]string{"limes_baz_total", "limes_foo_total_sum"},
+			[]string{"limes_foo_total", "limes_bar_total"},
+		),
+		Entry("glob characters that are special in regexes are matched literally",
+			[]string{"foo.bar+baz"},
+			nil,
+			[]string{"fooxbarrbaz"},
+			[]string{"foo.bar+baz"},
+		),
+		Entry("only list",
+			nil,
+			[]string{"limes_*"},
+			[]string{"limes_failed_scrapes"},
+			[]string{"swift_failed_scrapes"},
+		),
+		Entry("skip list takes precedence over only list",
+			[]string{"limes_failed_*"},
+			[]string{"limes_*"},
+			[]string{"limes_successful_scrapes"},
+			[]string{"limes_failed_scrapes", "swift_failed_scrapes"},
+		),
+	)
+
+	It("rejects invalid regexes", func() {
+		_, err := NewMetricNameFilter([]string{"/limes_(foo/"}, nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("allows all metric names if nil", func() {
+		var f *MetricNameFilter
+		Expect(f.Allows("ALERTS")).To(BeTrue())
+	})
+
+	It("parses newline-separated lists of patterns", func() {
+		in := "# error counters are only present on failure\nlimes_*_errors_total\n\n  ALERTS  \n"
+		Expect(splitMetricNamePatterns(in)).To(Equal([]string{"limes_*_errors_total", "ALERTS"}))
+	})
+})
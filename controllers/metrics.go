@@ -4,6 +4,8 @@
 package controllers
 
 import (
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
@@ -21,13 +23,29 @@ func RegisterMetrics() *prometheus.Registry {
 		// metrics related to the controller which will make testing with fixtures
 		// difficult.
 		reg := prometheus.NewPedanticRegistry()
-		reg.MustRegister(successfulReconcileTime)
+		reg.MustRegister(allMetrics()...)
 		return reg
 	}
-	metrics.Registry.MustRegister(successfulReconcileTime)
+	metrics.Registry.MustRegister(allMetrics()...)
 	return nil
 }
 
+func allMetrics() []prometheus.Collector {
+	return []prometheus.Collector{
+		successfulReconcileTime, unresolvedSelectors, skippedMetrics, parseErrors,
+		absenceRules, absencePromRuleOperations, absencePromRuleOperationDuration, orphanedRuleGroups,
+	}
+}
+
+// deletePrometheusRuleMetrics deletes all series of the given PrometheusRule, e.g. when
+// it is deleted or when the operator has been disabled for it.
+func deletePrometheusRuleMetrics(key types.NamespacedName) {
+	deleteReconcileGauge(key)
+	deleteUnresolvedSelectorsGauge(key)
+	deleteSkippedMetricsGauge(key)
+	deleteParseErrorsCounter(key)
+}
+
 var successfulReconcileTime = prometheus.NewGaugeVec(
 	prometheus.GaugeOpts{
 		Name: "absent_metrics_operator_successful_reconcile_time",
@@ -48,3 +66,123 @@ func setReconcileGauge(key types.NamespacedName) {
 func deleteReconcileGauge(key types.NamespacedName) {
 	successfulReconcileTime.DeleteLabelValues(key.Namespace, key.Name)
 }
+
+var unresolvedSelectors = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "absent_metrics_operator_unresolved_selectors",
+		Help: "The number of selectors in a specific PrometheusRule for which no metric name could be determined, e.g. due to an unbounded regex.",
+	},
+	[]string{"prometheusrule_namespace", "prometheusrule_name"},
+)
+
+func setUnresolvedSelectorsGauge(key types.NamespacedName, count int) {
+	unresolvedSelectors.WithLabelValues(key.Namespace, key.Name).Set(float64(count))
+}
+
+func deleteUnresolvedSelectorsGauge(key types.NamespacedName) {
+	unresolvedSelectors.DeleteLabelValues(key.Namespace, key.Name)
+}
+
+var skippedMetrics = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "absent_metrics_operator_skipped_metrics",
+		Help: "The number of metrics in a specific PrometheusRule for which no absence alert rule was generated, by reason. For the 'no_alert_on_absence' reason, the number of alert rules is counted instead.",
+	},
+	[]string{"prometheusrule_namespace", "prometheusrule_name", "reason"},
+)
+
+// setSkippedMetricsGauge replaces the series of the given PrometheusRule. Only reasons
+// with a non-zero count are reported.
+func setSkippedMetricsGauge(key types.NamespacedName, counts map[SkipReason]int) {
+	deleteSkippedMetricsGauge(key)
+	for reason, count := range counts {
+		if count > 0 {
+			skippedMetrics.WithLabelValues(key.Namespace, key.Name, string(reason)).Set(float64(count))
+		}
+	}
+}
+
+func deleteSkippedMetricsGauge(key types.NamespacedName) {
+	skippedMetrics.DeletePartialMatch(prometheus.Labels{"prometheusrule_namespace": key.Namespace, "prometheusrule_name": key.Name})
+}
+
+var parseErrors = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "absent_metrics_operator_parse_errors_total",
+		Help: "The number of times that no absence alert rules could be generated for a specific PrometheusRule, by reason.",
+	},
+	[]string{"prometheusrule_namespace", "prometheusrule_name", "reason"},
+)
+
+func incParseErrorsCounter(key types.NamespacedName, reason string) {
+	parseErrors.WithLabelValues(key.Namespace, key.Name, reason).Inc()
+}
+
+func deleteParseErrorsCounter(key types.NamespacedName) {
+	parseErrors.DeletePartialMatch(prometheus.Labels{"prometheusrule_namespace": key.Namespace, "prometheusrule_name": key.Name})
+}
+
+var absenceRules = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "absent_metrics_operator_absence_rules",
+		Help: "The number of absence alert rules in a specific AbsencePrometheusRule.",
+	},
+	[]string{"absenceprometheusrule_namespace", "absenceprometheusrule_name"},
+)
+
+func setAbsenceRulesGauge(key types.NamespacedName, count int) {
+	absenceRules.WithLabelValues(key.Namespace, key.Name).Set(float64(count))
+}
+
+func deleteAbsenceRulesGauge(key types.NamespacedName) {
+	absenceRules.DeleteLabelValues(key.Namespace, key.Name)
+}
+
+// These are the values for the "operation" label of absencePromRuleOperations and
+// absencePromRuleOperationDuration.
+const (
+	operationCreate = "create"
+	operationPatch  = "patch"
+	operationDelete = "delete"
+)
+
+var absencePromRuleOperations = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "absent_metrics_operator_absence_prometheusrule_operations_total",
+		Help: "The number of create, patch, and delete operations on AbsencePrometheusRules, by result.",
+	},
+	[]string{"operation", "result"},
+)
+
+var absencePromRuleOperationDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "absent_metrics_operator_absence_prometheusrule_operation_duration_seconds",
+		Help:    "The duration of create, patch, and delete operations on AbsencePrometheusRules.",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"operation"},
+)
+
+// observeOperation records an operation on an AbsencePrometheusRule that was started at
+// the given time.
+func observeOperation(operation string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	absencePromRuleOperations.WithLabelValues(operation, result).Inc()
+	absencePromRuleOperationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+var orphanedRuleGroups = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "absent_metrics_operator_orphaned_rule_groups_cleaned_up_total",
+		Help: "The number of rule groups that were removed from AbsencePrometheusRules because their PrometheusRule was deleted, disabled, or out of scope.",
+	},
+)
+
+func addOrphanedRuleGroups(count int) {
+	if count > 0 {
+		orphanedRuleGroups.Add(float64(count))
+	}
+}
@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Metrics", func() {
+	// series returns the number of series for each metric family in the registry.
+	series := func(reg *prometheus.Registry) map[string]int {
+		mfs, err := reg.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		result := make(map[string]int, len(mfs))
+		for _, mf := range mfs {
+			result[mf.GetName()] = len(mf.GetMetric())
+		}
+		return result
+	}
+
+	It("deletes all series of a PrometheusRule", func() {
+		reg := prometheus.NewPedanticRegistry()
+		reg.MustRegister(allMetrics()...)
+
+		key := types.NamespacedName{Namespace: "resmgmt", Name: "openstack-limes-api.alerts"}
+		other := types.NamespacedName{Namespace: "resmgmt", Name: "openstack-limes-roleassign.alerts"}
+		for _, k := range []types.NamespacedName{key, other} {
+			setReconcileGauge(k)
+			setUnresolvedSelectorsGauge(k, 1)
+			setSkippedMetricsGauge(k, map[SkipReason]int{SkipReasonUp: 2, SkipReasonGuarded: 1, SkipReasonFiltered: 0})
+			incParseErrorsCounter(k, eventReasonInvalidPolicy)
+		}
+		// Only reasons with a non-zero count are reported and previous series are replaced.
+		setSkippedMetricsGauge(key, map[SkipReason]int{SkipReasonUp: 1})
+		perPromRule := map[string]int{
+			"absent_metrics_operator_successful_reconcile_time": 2,
+			"absent_metrics_operator_unresolved_selectors":      2,
+			"absent_metrics_operator_skipped_metrics":           3,
+			"absent_metrics_operator_parse_errors_total":        2,
+		}
+		actual := series(reg)
+		for name, count := range perPromRule {
+			Expect(actual).To(HaveKeyWithValue(name, count))
+		}
+
+		deletePrometheusRuleMetrics(key)
+		deletePrometheusRuleMetrics(other)
+		actual = series(reg)
+		for name := range perPromRule {
+			Expect(actual).ToNot(HaveKey(name))
+		}
+	})
+
+	It("records operations on AbsencePrometheusRules", func() {
+		reg := prometheus.NewPedanticRegistry()
+		reg.MustRegister(allMetrics()...)
+		// Other tests, e.g. for Diff(), operate on AbsencePrometheusRules as well.
+		absenceRules.Reset()
+		absencePromRuleOperations.Reset()
+		absencePromRuleOperationDuration.Reset()
+
+		key := types.NamespacedName{Namespace: "resmgmt", Name: "openstack-absent-metric-alert-rules"}
+		setAbsenceRulesGauge(key, 3)
+		observeOperation(operationPatch, time.Now(), nil)
+		observeOperation(operationPatch, time.Now(), errors.New("conflict"))
+		addOrphanedRuleGroups(0)
+		actual := series(reg)
+		Expect(actual).To(HaveKeyWithValue("absent_metrics_operator_absence_rules", 1))
+		Expect(actual).To(HaveKeyWithValue("absent_metrics_operator_absence_prometheusrule_operations_total", 2))
+		Expect(actual).To(HaveKeyWithValue("absent_metrics_operator_absence_prometheusrule_operation_duration_seconds", 1))
+		Expect(actual).To(HaveKeyWithValue("absent_metrics_operator_orphaned_rule_groups_cleaned_up_total", 1))
+
+		deleteAbsenceRulesGauge(key)
+		Expect(series(reg)).ToNot(HaveKey("absent_metrics_operator_absence_rules"))
+	})
+})
@@ -0,0 +1,217 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	absentmetricsv1alpha1 "github.com/sapcc/absent-metrics-operator/api/v1alpha1"
+)
+
+// promRuleConfig is the configuration that is used for a specific PrometheusRule after
+// the policies that apply to it have been resolved.
+type promRuleConfig struct {
+	disabled           bool
+	prometheusRuleName *AbsencePromRuleNameGenerator
+	ruleOptions        RuleOptions
+}
+
+// policies holds the AbsenceRulePolicies and ClusterAbsenceRulePolicies that are
+// relevant for the PrometheusRules in a namespace. Each list is sorted by name.
+type policies struct {
+	cluster    []absentmetricsv1alpha1.ClusterAbsenceRulePolicy
+	namespaced []absentmetricsv1alpha1.AbsenceRulePolicy
+}
+
+// listPolicies returns the policies that apply to the given namespace. It returns no
+// policies if r.EnablePolicies is false.
+func (r *PrometheusRuleReconciler) listPolicies(ctx context.Context, namespace string) (policies, error) {
+	var result policies
+	if !r.EnablePolicies {
+		return result, nil
+	}
+
+	var ns corev1.Namespace
+	if err := r.Get(ctx, client.ObjectKey{Name: namespace}, &ns); err != nil {
+		return result, err
+	}
+	var clusterPolicies absentmetricsv1alpha1.ClusterAbsenceRulePolicyList
+	if err := r.List(ctx, &clusterPolicies); err != nil {
+		return result, err
+	}
+	for _, p := range clusterPolicies.Items {
+		ok, err := selectorMatches(p.Spec.NamespaceSelector, ns.Labels)
+		if err != nil {
+			return result, &ruleGroupParseError{
+				cause:  fmt.Errorf("invalid namespaceSelector in ClusterAbsenceRulePolicy %q: %w", p.Name, err),
+				reason: eventReasonInvalidPolicy,
+			}
+		}
+		if ok {
+			result.cluster = append(result.cluster, p)
+		}
+	}
+
+	var namespacedPolicies absentmetricsv1alpha1.AbsenceRulePolicyList
+	if err := r.List(ctx, &namespacedPolicies, client.InNamespace(namespace)); err != nil {
+		return result, err
+	}
+	result.namespaced = namespacedPolicies.Items
+
+	sort.Slice(result.cluster, func(i, j int) bool { return result.cluster[i].Name < result.cluster[j].Name })
+	sort.Slice(result.namespaced, func(i, j int) bool { return result.namespaced[i].Name < result.namespaced[j].Name })
+	return result, nil
+}
+
+// promRuleConfig returns the configuration for the given PrometheusRule.
+//
+// The configuration is resolved in the following order, where later sources override
+// earlier ones: flags (including the 'absent-metrics-operator/enable' label in
+// ModeOptIn), ClusterAbsenceRulePolicies, AbsenceRulePolicies, and the
+// 'absent-metrics-operator/disable' label on the PrometheusRule. The annotations of the
+// PrometheusRule and its alert rules are applied on top of the resulting RuleOptions
+// when the absence alert rules are generated.
+func (r *PrometheusRuleReconciler) promRuleConfig(ctx context.Context, p policies, promRule *monitoringv1.PrometheusRule) (promRuleConfig, error) {
+	base := promRuleConfig{
+		prometheusRuleName: r.PrometheusRuleName,
+		ruleOptions:        r.RuleOptions,
+	}
+	optedIn, err := r.promRuleOptedIn(ctx, promRule)
+	if err != nil {
+		return base, err
+	}
+	base.disabled = !optedIn
+	base.ruleOptions.MetricNameFilter, err = r.metricNameFilter(ctx)
+	if err != nil {
+		return base, err
+	}
+	return resolvePromRuleConfig(base, p, promRule)
+}
+
+// resolvePromRuleConfig applies the policies, whose PrometheusRule selector matches the
+// given PrometheusRule, to the base configuration.
+func resolvePromRuleConfig(base promRuleConfig, p policies, promRule *monitoringv1.PrometheusRule) (promRuleConfig, error) {
+	cfg := base
+	for _, cp := range p.cluster {
+		if err := cfg.applyPolicy(cp.Spec.AbsenceRulePolicySpec, promRule.Labels); err != nil {
+			return base, &ruleGroupParseError{
+				cause:  fmt.Errorf("invalid ClusterAbsenceRulePolicy %q: %w", cp.Name, err),
+				reason: eventReasonInvalidPolicy,
+			}
+		}
+	}
+	for _, np := range p.namespaced {
+		if err := cfg.applyPolicy(np.Spec, promRule.Labels); err != nil {
+			return base, &ruleGroupParseError{
+				cause:  fmt.Errorf("invalid AbsenceRulePolicy %s/%s: %w", np.Namespace, np.Name, err),
+				reason: eventReasonInvalidPolicy,
+			}
+		}
+	}
+	if v, ok := promRule.Labels[labelOperatorDisable]; ok {
+		cfg.disabled = parseBool(v)
+	}
+	return cfg, nil
+}
+
+// applyPolicy applies the fields of the given policy spec to the configuration if its
+// PrometheusRule selector matches the given labels.
+func (cfg *promRuleConfig) applyPolicy(spec absentmetricsv1alpha1.AbsenceRulePolicySpec, promRuleLabels map[string]string) error {
+	ok, err := selectorMatches(spec.PrometheusRuleSelector, promRuleLabels)
+	if err != nil {
+		return fmt.Errorf("invalid prometheusRuleSelector: %w", err)
+	}
+	if !ok {
+		return nil
+	}
+
+	opts := &cfg.ruleOptions
+	if spec.Disabled != nil {
+		cfg.disabled = *spec.Disabled
+	}
+	if spec.KeepLabels != nil {
+		opts.KeepLabel = make(KeepLabel, len(spec.KeepLabels))
+		for _, l := range spec.KeepLabels {
+			opts.KeepLabel[l] = true
+		}
+	}
+	if spec.KeepLabelMatchers != nil {
+		opts.KeepLabelMatchers = *spec.KeepLabelMatchers
+	}
+	if spec.SeverityMap != nil {
+		var m SeverityMap
+		for _, v := range spec.SeverityMap {
+			if v.Source == "" || v.Target == "" {
+				return fmt.Errorf("invalid severity mapping %q: source and target must not be empty", v.Source+"="+v.Target)
+			}
+			if _, _, exists := m.lookup(v.Source); exists {
+				return fmt.Errorf("duplicate severity mapping for %q", v.Source)
+			}
+			m = append(m, SeverityMapping{Source: v.Source, Target: v.Target})
+		}
+		opts.SeverityMap = m
+	}
+	if spec.AbsenceMode != "" {
+		if opts.AbsenceMode, err = ParseAbsenceMode(spec.AbsenceMode); err != nil {
+			return err
+		}
+	}
+	if spec.AbsenceRange != "" {
+		if opts.AbsenceRange, err = ParseDuration(spec.AbsenceRange); err != nil {
+			return err
+		}
+	}
+	if spec.AbsenceFor != "" {
+		if opts.AbsenceFor, err = ParseDuration(spec.AbsenceFor); err != nil {
+			return err
+		}
+	}
+	if spec.AbsenceForPolicy != "" {
+		if opts.AbsenceForPolicy, err = ParseAbsenceForPolicy(spec.AbsenceForPolicy); err != nil {
+			return err
+		}
+	}
+	if len(spec.SkipMetrics) > 0 || len(spec.OnlyMetrics) > 0 {
+		f, err := NewMetricNameFilter(spec.SkipMetrics, spec.OnlyMetrics)
+		if err != nil {
+			return err
+		}
+		opts.MetricNameFilter = opts.MetricNameFilter.merge(f)
+	}
+	if spec.PrometheusRuleName != "" {
+		if cfg.prometheusRuleName, err = CreateAbsencePromRuleNameGenerator(spec.PrometheusRuleName); err != nil {
+			return fmt.Errorf("invalid prometheusRuleName template: %w", err)
+		}
+	}
+	return nil
+}
+
+// selectorMatches returns true if the given label selector matches the labels. A nil
+// selector matches everything.
+func selectorMatches(selector *metav1.LabelSelector, l map[string]string) (bool, error) {
+	if selector == nil {
+		return true, nil
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false, err
+	}
+	return s.Matches(labels.Set(l)), nil
+}
+
+// enqueuePrometheusRulesInNamespace returns reconcile requests for all PrometheusRules,
+// except AbsencePrometheusRules, in the namespace of the given object. It is used when
+// an AbsenceRulePolicy changes.
+func (r *PrometheusRuleReconciler) enqueuePrometheusRulesInNamespace(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.enqueuePrometheusRules(ctx, client.InNamespace(obj.GetNamespace()))
+}
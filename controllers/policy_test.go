@@ -0,0 +1,170 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	absentmetricsv1alpha1 "github.com/sapcc/absent-metrics-operator/api/v1alpha1"
+)
+
+var _ = Describe("Policies", func() {
+	promRule := &monitoringv1.PrometheusRule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "openstack-limes-api.alerts",
+			Namespace: "resmgmt",
+			Labels:    map[string]string{"prometheus": "openstack", "tier": "os"},
+		},
+	}
+	nameGen, err := CreateAbsencePromRuleNameGenerator("openstack")
+	Expect(err).ToNot(HaveOccurred())
+	base := promRuleConfig{
+		prometheusRuleName: nameGen,
+		ruleOptions: RuleOptions{
+			KeepLabel:   KeepLabel{LabelSupportGroup: true, LabelTier: true, LabelService: true},
+			AbsenceMode: AbsenceModeAbsent,
+			AbsenceFor:  "10m",
+		},
+	}
+	yes, no := true, false
+
+	clusterPolicy := func(name string, spec absentmetricsv1alpha1.AbsenceRulePolicySpec) absentmetricsv1alpha1.ClusterAbsenceRulePolicy {
+		return absentmetricsv1alpha1.ClusterAbsenceRulePolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       absentmetricsv1alpha1.ClusterAbsenceRulePolicySpec{AbsenceRulePolicySpec: spec},
+		}
+	}
+	namespacedPolicy := func(name string, spec absentmetricsv1alpha1.AbsenceRulePolicySpec) absentmetricsv1alpha1.AbsenceRulePolicy {
+		return absentmetricsv1alpha1.AbsenceRulePolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "resmgmt"},
+			Spec:       spec,
+		}
+	}
+
+	It("uses the base configuration if there are no policies", func() {
+		cfg, err := resolvePromRuleConfig(base, policies{}, promRule)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cfg.disabled).To(BeFalse())
+		Expect(cfg.ruleOptions).To(Equal(base.ruleOptions))
+	})
+
+	It("applies namespaced policies over cluster policies", func() {
+		p := policies{
+			cluster: []absentmetricsv1alpha1.ClusterAbsenceRulePolicy{
+				clusterPolicy("a", absentmetricsv1alpha1.AbsenceRulePolicySpec{
+					KeepLabels:  []string{"support_group"},
+					AbsenceMode: "over_time",
+					AbsenceFor:  "30m",
+					SeverityMap: []absentmetricsv1alpha1.SeverityMapping{{Source: "critical", Target: "warning"}},
+				}),
+			},
+			namespaced: []absentmetricsv1alpha1.AbsenceRulePolicy{
+				namespacedPolicy("a", absentmetricsv1alpha1.AbsenceRulePolicySpec{
+					AbsenceFor:         "1h",
+					AbsenceForPolicy:   "multiply:2",
+					KeepLabelMatchers:  &yes,
+					SkipMetrics:        []string{"limes_*"},
+					PrometheusRuleName: "{{ .metadata.namespace }}",
+				}),
+				namespacedPolicy("b", absentmetricsv1alpha1.AbsenceRulePolicySpec{
+					PrometheusRuleSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"prometheus": "kubernetes"}},
+					AbsenceFor:             "2h",
+				}),
+			},
+		}
+		cfg, err := resolvePromRuleConfig(base, p, promRule)
+		Expect(err).ToNot(HaveOccurred())
+
+		opts := cfg.ruleOptions
+		Expect(opts.KeepLabel).To(Equal(KeepLabel{LabelSupportGroup: true}))
+		Expect(opts.KeepLabelMatchers).To(BeTrue())
+		Expect(opts.AbsenceMode).To(Equal(AbsenceModeOverTime))
+		Expect(opts.AbsenceFor).To(Equal(monitoringv1.Duration("1h")))
+		Expect(opts.AbsenceForPolicy).To(Equal(AbsenceForPolicy{Kind: AbsenceForPolicyMultiply, Factor: 2}))
+		Expect(opts.SeverityMap).To(Equal(SeverityMap{{Source: "critical", Target: "warning"}}))
+		Expect(opts.MetricNameFilter.Allows("limes_foo")).To(BeFalse())
+		Expect(opts.MetricNameFilter.Allows("keppel_foo")).To(BeTrue())
+		Expect(cfg.prometheusRuleName.Generate(promRule)).To(Equal("resmgmt" + absencePromRuleNameSuffix))
+
+		// The base configuration must not be modified.
+		Expect(base.ruleOptions.KeepLabel).To(HaveLen(3))
+	})
+
+	DescribeTable("Disabling",
+		func(p policies, disableLabel string, expected bool) {
+			pr := promRule.DeepCopy()
+			if disableLabel != "" {
+				pr.Labels[labelOperatorDisable] = disableLabel
+			}
+			cfg, err := resolvePromRuleConfig(base, p, pr)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cfg.disabled).To(Equal(expected))
+		},
+		Entry("by label", policies{}, "true", true),
+		Entry("by cluster policy",
+			policies{cluster: []absentmetricsv1alpha1.ClusterAbsenceRulePolicy{
+				clusterPolicy("a", absentmetricsv1alpha1.AbsenceRulePolicySpec{Disabled: &yes}),
+			}},
+			"", true,
+		),
+		Entry("by cluster policy and enabled again by namespaced policy",
+			policies{
+				cluster: []absentmetricsv1alpha1.ClusterAbsenceRulePolicy{
+					clusterPolicy("a", absentmetricsv1alpha1.AbsenceRulePolicySpec{Disabled: &yes}),
+				},
+				namespaced: []absentmetricsv1alpha1.AbsenceRulePolicy{
+					namespacedPolicy("a", absentmetricsv1alpha1.AbsenceRulePolicySpec{
+						PrometheusRuleSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "os"}},
+						Disabled:               &no,
+					}),
+				},
+			},
+			"", false,
+		),
+		Entry("by namespaced policy and enabled again by label",
+			policies{namespaced: []absentmetricsv1alpha1.AbsenceRulePolicy{
+				namespacedPolicy("a", absentmetricsv1alpha1.AbsenceRulePolicySpec{Disabled: &yes}),
+			}},
+			"false", false,
+		),
+		Entry("by namespaced policy whose selector does not match",
+			policies{namespaced: []absentmetricsv1alpha1.AbsenceRulePolicy{
+				namespacedPolicy("a", absentmetricsv1alpha1.AbsenceRulePolicySpec{
+					PrometheusRuleSelector: &metav1.LabelSelector{
+						MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"os"}}},
+					},
+					Disabled: &yes,
+				}),
+			}},
+			"", false,
+		),
+	)
+
+	DescribeTable("Invalid policies",
+		func(spec absentmetricsv1alpha1.AbsenceRulePolicySpec) {
+			p := policies{namespaced: []absentmetricsv1alpha1.AbsenceRulePolicy{namespacedPolicy("a", spec)}}
+			_, err := resolvePromRuleConfig(base, p, promRule)
+			Expect(err).To(HaveOccurred())
+			_, ok := err.(*ruleGroupParseError)
+			Expect(ok).To(BeTrue())
+		},
+		Entry("invalid selector", absentmetricsv1alpha1.AbsenceRulePolicySpec{
+			PrometheusRuleSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: "Foo"}},
+			},
+		}),
+		Entry("invalid absence mode", absentmetricsv1alpha1.AbsenceRulePolicySpec{AbsenceMode: "present"}),
+		Entry("invalid absence range", absentmetricsv1alpha1.AbsenceRulePolicySpec{AbsenceRange: "1 hour"}),
+		Entry("invalid absence for", absentmetricsv1alpha1.AbsenceRulePolicySpec{AbsenceFor: "10 minutes"}),
+		Entry("invalid absence for policy", absentmetricsv1alpha1.AbsenceRulePolicySpec{AbsenceForPolicy: "min"}),
+		Entry("duplicate severity mapping", absentmetricsv1alpha1.AbsenceRulePolicySpec{
+			SeverityMap: []absentmetricsv1alpha1.SeverityMapping{{Source: "critical", Target: "warning"}, {Source: "critical", Target: "info"}},
+		}),
+		Entry("invalid metric name pattern", absentmetricsv1alpha1.AbsenceRulePolicySpec{SkipMetrics: []string{"/limes_(/"}}),
+		Entry("invalid PrometheusRule name template", absentmetricsv1alpha1.AbsenceRulePolicySpec{PrometheusRuleName: "{{ .metadata.name"}),
+	)
+})
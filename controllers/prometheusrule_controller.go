@@ -12,11 +12,19 @@ import (
 	"github.com/go-logr/logr"
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	"github.com/sapcc/go-bits/errext"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	absentmetricsv1alpha1 "github.com/sapcc/absent-metrics-operator/api/v1alpha1"
 )
 
 const logLevelDebug int = 1
@@ -33,17 +41,66 @@ var requeueInterval = 5 * time.Minute
 // PrometheusRuleReconciler reconciles a PrometheusRule object.
 type PrometheusRuleReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
-	Log    logr.Logger
+	Scheme   *runtime.Scheme
+	Log      logr.Logger
+	Recorder record.EventRecorder
+
+	PrometheusRuleName *AbsencePromRuleNameGenerator
+	// RuleOptions are the default options for generating absence alert rules. They can
+	// be overridden for a specific PrometheusRule or alert rule using annotations.
+	RuleOptions RuleOptions
+	// MetricNameFilterConfigMap optionally references a ConfigMap that contains
+	// additional patterns for the MetricNameFilter. The ConfigMap is watched and changes
+	// to it are applied without a restart.
+	MetricNameFilterConfigMap types.NamespacedName
+	// AggregateSourceAlerts specifies whether the absence alert rules in an
+	// AbsencePrometheusRule list the alert rules from all the PrometheusRules that use
+	// their metric, in addition to the ones from their own PrometheusRule.
+	AggregateSourceAlerts bool
+	// EnablePolicies specifies whether AbsenceRulePolicies and ClusterAbsenceRulePolicies
+	// are taken into account. Their CRDs must be installed if this is true.
+	EnablePolicies bool
+	// UseFinalizer specifies whether a finalizer is added to PrometheusRules so that their
+	// absence alert rules are removed before they are deleted. If it is false then the
+	// finalizer is removed from PrometheusRules that still have it.
+	UseFinalizer bool
+	// Scope restricts the PrometheusRules that absence alert rules are generated for.
+	// The absence alert rules of PrometheusRules that are out of scope are cleaned up.
+	Scope Scope
+	// NamespaceSelectionChanged is called when a namespace starts or stops matching the
+	// NamespaceSelector after the SelectedNamespaces of the Scope were determined. The
+	// cache has to be set up again in this case, e.g. by restarting the operator.
+	NamespaceSelectionChanged func()
+	// Mode specifies whether absence alert rules are generated for PrometheusRules by
+	// default. The zero value behaves like ModeOptOut.
+	Mode Mode
+	// APIReader is used to look up objects that are not in the cache because they are
+	// out of scope. It is optional.
+	APIReader client.Reader
+	// DryRun specifies that AbsencePrometheusRules are not created, patched, or deleted.
+	// Instead, the operations are logged and counted in the metrics as if they had
+	// happened. The finalizer and the status annotations of PrometheusRules are not
+	// updated and no events are emitted either.
+	DryRun bool
+	// DryRunConfigMap optionally references a ConfigMap in which the operations that
+	// were skipped because of DryRun are recorded, see DryRunConfigMapKey. It is created
+	// if it does not exist.
+	DryRunConfigMap types.NamespacedName
 
-	PrometheusRuleName AbsencePromRuleNameGenerator
-	// KeepLabel is a map of labels that will be retained from the original alert rule and
-	// passed on to its corresponding absence alert rule.
-	KeepLabel KeepLabel
+	metricNameFilterCache metricNameFilterCache
+	eventCache            eventCache
+	// dryRunRecorder is called with each operation that is skipped because of DryRun,
+	// see recordDryRun. It is used by Diff.
+	dryRunRecorder func(ctx context.Context, operation string, absencePromRule *monitoringv1.PrometheusRule) error
 }
 
 //+kubebuilder:rbac:groups=monitoring.coreos.com,resources=prometheusrules,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=monitoring.coreos.com,resources=prometheusrules/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=monitoring.coreos.com,resources=prometheusrules/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;patch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups=absentmetrics.cloud.sap,resources=absencerulepolicies;clusterabsencerulepolicies,verbs=get;list;watch
 
 // Reconcile is part of the main Kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -71,6 +128,9 @@ func (r *PrometheusRuleReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 			// rules. Instead, we wait for the next time the resource is updated or until
 			// the requeueInterval is elapsed (whichever happens first).
 			log.Error(perr, "could not parse rule groups")
+			incParseErrorsCounter(req.NamespacedName, perr.eventReason())
+			r.recordEvent(&promRule, corev1.EventTypeWarning, perr.eventReason(),
+				"Could not generate absence alert rules: %s", perr.Error())
 			return ctrl.Result{RequeueAfter: requeueInterval}, nil
 		}
 		// Requeue for later processing.
@@ -86,15 +146,58 @@ func (r *PrometheusRuleReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *PrometheusRuleReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&monitoringv1.PrometheusRule{}).
-		Complete(r)
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&monitoringv1.PrometheusRule{}, builder.WithPredicates(ignoreStatusUpdates)).
+		// Reconcile the source PrometheusRules when an AbsencePrometheusRule is changed or
+		// deleted by someone else, so that manual changes to it are repaired immediately.
+		Watches(&monitoringv1.PrometheusRule{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueSourcePrometheusRules),
+			builder.WithPredicates(predicate.NewPredicateFuncs(isRepairableAbsencePrometheusRule), changedByOthers),
+		)
+	if r.MetricNameFilterConfigMap.Name != "" {
+		// Reconcile all PrometheusRules when the metric name filter changes.
+		b = b.Watches(&corev1.ConfigMap{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueAllPrometheusRules),
+			builder.WithPredicates(predicate.NewPredicateFuncs(r.isMetricNameFilterConfigMap)),
+		)
+	}
+	if r.Scope.NamespaceSelector != nil || r.Mode == ModeOptIn {
+		// Reconcile the PrometheusRules in a namespace when it falls in or out of scope
+		// or when it opts in or out.
+		b = b.Watches(&corev1.Namespace{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueuePrometheusRulesInChangedNamespace),
+			builder.WithPredicates(namespaceLabelsChanged),
+		)
+	}
+	if r.Scope.SelectedNamespaces != nil && r.NamespaceSelectionChanged != nil {
+		// The cache only holds the objects in the namespaces that matched the
+		// NamespaceSelector when it was set up.
+		b = b.Watches(&corev1.Namespace{},
+			handler.EnqueueRequestsFromMapFunc(func(context.Context, client.Object) []reconcile.Request {
+				r.NamespaceSelectionChanged()
+				return nil
+			}),
+			builder.WithPredicates(predicate.NewPredicateFuncs(r.Scope.namespaceSelectionChanged)),
+		)
+	}
+	if r.EnablePolicies {
+		// Reconcile the PrometheusRules that a policy could apply to when it changes.
+		b = b.Watches(&absentmetricsv1alpha1.AbsenceRulePolicy{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueuePrometheusRulesInNamespace),
+		).Watches(&absentmetricsv1alpha1.ClusterAbsenceRulePolicy{},
+			handler.EnqueueRequestsFromMapFunc(r.enqueueAllPrometheusRules),
+		)
+	}
+	return b.Complete(r)
 }
 
 // handleObjectNotFound is a helper function for Reconcile(). It exists separately so that
 // we can exit on error without making the `switch` in Reconcile() complex.
 func (r *PrometheusRuleReconciler) handleObjectNotFound(ctx context.Context, key types.NamespacedName) (ctrl.Result, error) {
 	log := r.Log.WithValues("name", key.Name, "namespace", key.Namespace)
+	// The object could have been an AbsencePrometheusRule that was deleted by someone
+	// else.
+	deleteAbsenceRulesGauge(key)
 
 	// Step 1: check if the object is a PrometheusRule or an AbsencePrometheusRule.
 	if strings.HasSuffix(key.Name, absencePromRuleNameSuffix) {
@@ -122,7 +225,10 @@ func (r *PrometheusRuleReconciler) handleObjectNotFound(ctx context.Context, key
 	} else {
 		log.V(logLevelDebug).Info("successfully cleaned up orphaned absence alert rules")
 	}
-	deleteReconcileGauge(key)
+	if err := r.handleOutOfScope(ctx, key); err != nil {
+		log.Error(err, "could not remove finalizer from PrometheusRule that is out of scope")
+	}
+	deletePrometheusRuleMetrics(key)
 	return ctrl.Result{}, nil
 }
 
@@ -141,6 +247,7 @@ func (r *PrometheusRuleReconciler) reconcileObject(
 	if parseBool(l[labelOperatorManagedBy]) {
 		// If it's an AbsencePrometheusRule then do a clean up, i.e. remove any absence
 		// metric alert rules from it that no longer belong to any PrometheusRule.
+		setAbsenceRulesGauge(key, countRules(obj.Spec.Groups))
 		updatedAt, err := time.Parse(time.RFC3339, obj.Annotations[annotationOperatorUpdatedAt])
 		if err != nil && time.Now().UTC().Sub(updatedAt) < requeueInterval {
 			// No need for clean up if the AbsencePrometheusRule was updated recently.
@@ -154,9 +261,17 @@ func (r *PrometheusRuleReconciler) reconcileObject(
 		return err
 	}
 
-	// Step 2: if it's a PrometheusRule then check if the operator has been disabled
-	// for it. If it is disabled then try to clean up the orphaned absence alert rules
-	// from any corresponding AbsencePrometheusRule.
+	// Step 2: if it's a PrometheusRule that is being deleted then clean up its absence
+	// alert rules before its finalizer is removed.
+	if !obj.GetDeletionTimestamp().IsZero() {
+		return r.finalizePrometheusRule(ctx, key, obj)
+	}
+
+	// Step 3: check if the operator has been disabled for the PrometheusRule, either by
+	// label or by a policy, if it has not opted in (in ModeOptIn), or if it is out of
+	// scope. If so then try to clean up the
+	// orphaned absence alert rules from any corresponding AbsencePrometheusRule and
+	// remove the finalizer.
 	//
 	// We choose to absorb the error here as returning the error would requeue the
 	// resource for immediate processing and we'll be stuck trying to clean up the
@@ -164,28 +279,57 @@ func (r *PrometheusRuleReconciler) reconcileObject(
 	// corresponding AbsencePrometheusRule. Instead, we wait until the next time when all
 	// AbsencePrometheusRules are requeued for processing (after the requeueInterval is
 	// elapsed).
-	if parseBool(l[labelOperatorDisable]) {
+	p, err := r.listPolicies(ctx, key.Namespace)
+	if err != nil {
+		return err
+	}
+	cfg, err := r.promRuleConfig(ctx, p, obj)
+	if err != nil {
+		r.reportStatus(ctx, obj, promRuleStatus{}, err)
+		return err
+	}
+	enabled, err := r.isEnabled(ctx, cfg, obj)
+	if err != nil {
+		return err
+	}
+	if !enabled {
 		log.V(logLevelDebug).Info("operator disabled for this PrometheusRule")
-		aPRName, err := r.PrometheusRuleName(obj)
+		aPRName, err := cfg.prometheusRuleName.Generate(obj)
 		if err == nil {
 			err = r.cleanUpOrphanedAbsenceAlertRules(ctx, key, aPRName)
 		}
-		if err != nil {
-			if !apierrors.IsNotFound(err) && !errors.Is(err, errCorrespondingAbsencePromRuleNotExists) {
-				log.Error(err, "could not clean up orphaned absence alert rules")
-			}
-		} else {
+		// If there is no corresponding AbsencePrometheusRule then there is nothing to
+		// clean up but the finalizer is no longer needed either.
+		notExists := apierrors.IsNotFound(err) || errors.Is(err, errCorrespondingAbsencePromRuleNotExists)
+		switch {
+		case err == nil:
 			log.V(logLevelDebug).Info("successfully cleaned up orphaned absence alert rules")
+		case notExists:
+			log.V(logLevelDebug).Info("no corresponding AbsencePrometheusRule to clean up")
+		default:
+			log.Error(err, "could not clean up orphaned absence alert rules")
+		}
+		if err == nil || notExists {
+			if err := r.updateFinalizer(ctx, obj, false); err != nil {
+				return err
+			}
 		}
-		deleteReconcileGauge(key)
+		deletePrometheusRuleMetrics(key)
+		r.clearStatus(ctx, obj)
 		return nil
 	}
 
-	// Step 3: Generate the corresponding absence alert rules for this resource.
-	err := r.updateAbsenceAlertRules(ctx, obj)
+	// Step 4: Generate the corresponding absence alert rules for this resource and
+	// report the result back to it. The finalizer is added beforehand so that the
+	// absence alert rules can not outlive the PrometheusRule.
+	if err := r.updateFinalizer(ctx, obj, r.UseFinalizer); err != nil {
+		return err
+	}
+	status, err := r.updateAbsenceAlertRules(ctx, obj, cfg)
 	if err == nil {
 		setReconcileGauge(key)
 		log.V(logLevelDebug).Info("successfully reconciled PrometheusRule")
 	}
+	r.reportStatus(ctx, obj, status, err)
 	return err
 }
@@ -0,0 +1,294 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/prometheus/common/model"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AbsenceMode specifies which function is used in the expression of an absence alert rule.
+type AbsenceMode string
+
+const (
+	// AbsenceModeAbsent results in absence alert rules of the form: absent(metric).
+	AbsenceModeAbsent AbsenceMode = "absent"
+	// AbsenceModeOverTime results in absence alert rules of the form:
+	// absent_over_time(metric[range]).
+	AbsenceModeOverTime AbsenceMode = "over_time"
+)
+
+// These are the default values that are used if the corresponding RuleOptions are empty.
+const (
+	DefaultAbsenceMode  = AbsenceModeAbsent
+	DefaultAbsenceRange = monitoringv1.Duration("1h")
+	DefaultAbsenceFor   = monitoringv1.Duration("10m")
+)
+
+// ParseAbsenceMode parses an AbsenceMode from a string.
+func ParseAbsenceMode(in string) (AbsenceMode, error) {
+	switch m := AbsenceMode(in); m {
+	case AbsenceModeAbsent, AbsenceModeOverTime:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid absence mode %q: expected %q or %q", in, AbsenceModeAbsent, AbsenceModeOverTime)
+	}
+}
+
+// ParseDuration validates that a string is a valid Prometheus duration.
+func ParseDuration(in string) (monitoringv1.Duration, error) {
+	if _, err := model.ParseDuration(in); err != nil {
+		return "", fmt.Errorf("invalid duration %q: %w", in, err)
+	}
+	return monitoringv1.Duration(in), nil
+}
+
+// AbsenceForPolicyKind specifies how the 'for' duration of an absence alert rule is
+// determined.
+type AbsenceForPolicyKind string
+
+const (
+	// AbsenceForPolicyFixed always uses RuleOptions.AbsenceFor.
+	AbsenceForPolicyFixed AbsenceForPolicyKind = "fixed"
+	// AbsenceForPolicyMax uses the 'for' duration of the original alert rule, with
+	// RuleOptions.AbsenceFor as the lower bound.
+	AbsenceForPolicyMax AbsenceForPolicyKind = "max"
+	// AbsenceForPolicyMultiply multiplies the 'for' duration of the original alert rule
+	// with a factor. RuleOptions.AbsenceFor is used if the original alert rule does not
+	// have a 'for' duration.
+	AbsenceForPolicyMultiply AbsenceForPolicyKind = "multiply"
+)
+
+// AbsenceForPolicy specifies how the 'for' duration of an absence alert rule is derived
+// from the 'for' duration of the original alert rule.
+type AbsenceForPolicy struct {
+	Kind AbsenceForPolicyKind
+	// Factor is only used with AbsenceForPolicyMultiply.
+	Factor float64
+}
+
+// ParseAbsenceForPolicy parses an AbsenceForPolicy from a string. Valid values are:
+// 'fixed', 'max', and 'multiply:<factor>' (e.g. 'multiply:2').
+func ParseAbsenceForPolicy(in string) (AbsenceForPolicy, error) {
+	kind, factorStr, hasFactor := strings.Cut(in, ":")
+	switch p := AbsenceForPolicyKind(kind); p {
+	case AbsenceForPolicyFixed, AbsenceForPolicyMax:
+		if hasFactor {
+			return AbsenceForPolicy{}, fmt.Errorf("invalid absence for policy %q: %q does not take a factor", in, p)
+		}
+		return AbsenceForPolicy{Kind: p}, nil
+	case AbsenceForPolicyMultiply:
+		factor, err := strconv.ParseFloat(factorStr, 64)
+		if err != nil || factor <= 0 {
+			return AbsenceForPolicy{}, fmt.Errorf("invalid absence for policy %q: expected a positive factor, e.g. 'multiply:2'", in)
+		}
+		return AbsenceForPolicy{Kind: p, Factor: factor}, nil
+	default:
+		return AbsenceForPolicy{}, fmt.Errorf("invalid absence for policy %q: expected 'fixed', 'max', or 'multiply:<factor>'", in)
+	}
+}
+
+// String implements the fmt.Stringer interface.
+func (p AbsenceForPolicy) String() string {
+	if p.Kind == AbsenceForPolicyMultiply {
+		return fmt.Sprintf("%s:%s", p.Kind, strconv.FormatFloat(p.Factor, 'f', -1, 64))
+	}
+	return string(p.Kind)
+}
+
+// absenceFor returns the 'for' duration for an absence alert rule based on the 'for'
+// duration of the original alert rule.
+func (opts RuleOptions) absenceFor(source *monitoringv1.Duration) (monitoringv1.Duration, error) {
+	base := opts.AbsenceFor
+	if base == "" {
+		base = DefaultAbsenceFor
+	}
+	if opts.AbsenceForPolicy.Kind == "" || opts.AbsenceForPolicy.Kind == AbsenceForPolicyFixed {
+		return base, nil
+	}
+
+	var sourceDuration model.Duration
+	if source != nil && *source != "" {
+		var err error
+		sourceDuration, err = model.ParseDuration(string(*source))
+		if err != nil {
+			return "", fmt.Errorf("invalid 'for' duration %q: %w", *source, err)
+		}
+	}
+	if sourceDuration == 0 {
+		return base, nil
+	}
+
+	switch opts.AbsenceForPolicy.Kind {
+	case AbsenceForPolicyMax:
+		baseDuration, err := model.ParseDuration(string(base))
+		if err != nil {
+			return "", err
+		}
+		if baseDuration >= sourceDuration {
+			return base, nil
+		}
+		return monitoringv1.Duration(sourceDuration.String()), nil
+	case AbsenceForPolicyMultiply:
+		d := time.Duration(float64(sourceDuration) * opts.AbsenceForPolicy.Factor).Round(time.Second)
+		return monitoringv1.Duration(model.Duration(d).String()), nil
+	default:
+		return base, nil
+	}
+}
+
+// DefaultAbsenceSeverity is the severity of absence alert rules whose original alert
+// rules have a severity that is not covered by the SeverityMap.
+const DefaultAbsenceSeverity = "info"
+
+// SeverityMapping maps the severity of an original alert rule to the severity of its
+// absence alert rules.
+type SeverityMapping struct {
+	Source string
+	Target string
+}
+
+// SeverityMap is an ordered list of SeverityMapping(s). The order specifies the
+// priority of the source severities: if multiple alert rules with different
+// severities use the same metric then the first matching SeverityMapping is used.
+type SeverityMap []SeverityMapping
+
+// ParseSeverityMap parses a SeverityMap from a comma-separated list of
+// 'source=target' pairs, e.g. 'critical=warning,warning=info'.
+func ParseSeverityMap(in string) (SeverityMap, error) {
+	var result SeverityMap
+	for v := range strings.SplitSeq(in, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		source, target, ok := strings.Cut(v, "=")
+		source, target = strings.TrimSpace(source), strings.TrimSpace(target)
+		if !ok || source == "" || target == "" {
+			return nil, fmt.Errorf("invalid severity mapping %q: expected 'source=target'", v)
+		}
+		if _, _, exists := result.lookup(source); exists {
+			return nil, fmt.Errorf("duplicate severity mapping for %q", source)
+		}
+		result = append(result, SeverityMapping{Source: source, Target: target})
+	}
+	return result, nil
+}
+
+// String implements the fmt.Stringer interface.
+func (m SeverityMap) String() string {
+	list := make([]string, 0, len(m))
+	for _, v := range m {
+		list = append(list, v.Source+"="+v.Target)
+	}
+	return strings.Join(list, ",")
+}
+
+// lookup returns the target severity and the priority for a source severity.
+func (m SeverityMap) lookup(source string) (target string, rank int, ok bool) {
+	for i, v := range m {
+		if v.Source == source {
+			return v.Target, i, true
+		}
+	}
+	return "", 0, false
+}
+
+// RuleOptions specifies how absence alert rules are generated.
+type RuleOptions struct {
+	// KeepLabel is a map of labels that will be retained from the original alert rule and
+	// passed on to its corresponding absence alert rule.
+	KeepLabel KeepLabel
+	// KeepLabelMatchers specifies whether the equality label matchers that were used
+	// with a metric in the original alert rule expression are retained in the
+	// expression of its corresponding absence alert rule. If a metric is used with
+	// different label matchers then one absence alert rule is generated for each
+	// distinct selector.
+	KeepLabelMatchers bool
+	// MetricNameFilter decides which metrics are considered for absence alert rules. A
+	// nil filter allows all metrics.
+	MetricNameFilter *MetricNameFilter
+	// AbsenceMode specifies the function that is used in absence alert rule
+	// expressions. DefaultAbsenceMode is used if empty.
+	AbsenceMode AbsenceMode
+	// AbsenceRange is the range that is used with AbsenceModeOverTime.
+	// DefaultAbsenceRange is used if empty.
+	AbsenceRange monitoringv1.Duration
+	// AbsenceFor is the 'for' duration of absence alert rules. DefaultAbsenceFor is
+	// used if empty. Depending on the AbsenceForPolicy, it is used as a fixed value, a
+	// lower bound, or a fallback.
+	AbsenceFor monitoringv1.Duration
+	// AbsenceForPolicy specifies how the 'for' duration of absence alert rules is
+	// derived from the 'for' duration of the original alert rules.
+	// AbsenceForPolicyFixed is used if empty.
+	AbsenceForPolicy AbsenceForPolicy
+	// SeverityMap maps the severity of the original alert rules to the severity of
+	// absence alert rules. DefaultAbsenceSeverity is used for unmapped severities.
+	SeverityMap SeverityMap
+	// Template is used to render absence alert rules. The DefaultAbsenceRuleTemplate is
+	// used if nil.
+	Template *AbsenceRuleTemplate
+
+	// PrometheusRule is the metadata of the PrometheusRule that the alert rules belong
+	// to. It is made available to the Template.
+	PrometheusRule metav1.ObjectMeta
+	// OnUnresolvedSelector, if not nil, is called for each VectorSelector in an alert
+	// rule expression for which no metric name could be determined. This is the case
+	// for selectors that match metric names using an unbounded regex, e.g.
+	// {__name__=~"foo_.*"}.
+	OnUnresolvedSelector func(alert, selector string)
+	// OnSkippedMetric, if not nil, is called for each metric in an alert rule expression
+	// for which no absence alert rule is generated. For SkipReasonNoAlertOnAbsence, it
+	// is called once per alert rule with an empty metric since the expression is not
+	// parsed. For SkipReasonUnresolved, the metric is the VectorSelector.
+	OnSkippedMetric func(alert, metric string, reason SkipReason)
+}
+
+// WithAnnotations returns a copy of the RuleOptions where options have been overridden
+// using the given annotations. The annotations can be specified either on a
+// PrometheusRule or on a specific alert rule.
+func (opts RuleOptions) WithAnnotations(annotations map[string]string) (RuleOptions, error) {
+	if v, ok := annotations[annotationKeepLabelMatchers]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid value for %s annotation: %w", annotationKeepLabelMatchers, err)
+		}
+		opts.KeepLabelMatchers = b
+	}
+	if v, ok := annotations[annotationAbsenceMode]; ok {
+		m, err := ParseAbsenceMode(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid value for %s annotation: %w", annotationAbsenceMode, err)
+		}
+		opts.AbsenceMode = m
+	}
+	if v, ok := annotations[annotationAbsenceRange]; ok {
+		d, err := ParseDuration(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid value for %s annotation: %w", annotationAbsenceRange, err)
+		}
+		opts.AbsenceRange = d
+	}
+	if v, ok := annotations[annotationAbsenceFor]; ok {
+		d, err := ParseDuration(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid value for %s annotation: %w", annotationAbsenceFor, err)
+		}
+		opts.AbsenceFor = d
+	}
+	if v, ok := annotations[annotationAbsenceForPolicy]; ok {
+		p, err := ParseAbsenceForPolicy(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid value for %s annotation: %w", annotationAbsenceForPolicy, err)
+		}
+		opts.AbsenceForPolicy = p
+	}
+	return opts, nil
+}
@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultAbsenceRuleTemplate is the template that is used for absence alert rules if no
+// other template is provided.
+//
+// TODO: remove the link from description and add a 'playbook' label,
+// when our upstream solution gets the ability to process hardcoded
+// links in the 'playbook' label.
+const DefaultAbsenceRuleTemplate = `expr: {{ quote .expr }}
+for: {{ quote .for }}
+labels:
+  context: {{ with index .labels "context" }}{{ quote . }}{{ else }}absent-metrics{{ end }}
+  severity: {{ with index .labels "severity" }}{{ quote . }}{{ else }}{{ quote .severity }}{{ end }}
+{{- range $k, $v := .labels }}{{ if and (ne $k "context") (ne $k "severity") }}
+  {{ quote $k }}: {{ quote $v }}
+{{- end }}{{ end }}
+annotations:
+  summary: {{ quote (print "missing " .selector) }}
+  description: {{ quote (printf "The metric '%s' is missing. '%s' alert using it may not fire as intended. See <https://github.com/sapcc/absent-metrics-operator/blob/master/docs/playbook.md|the operator playbook>." .selector .sourceAlert) }}
+`
+
+// AbsenceRuleTemplate renders the expression, 'for' duration, labels, and annotations
+// of absence alert rules.
+//
+// The template must produce a YAML document with the following keys: expr, for, labels,
+// and annotations. The following data is available in the template:
+//
+//	.alert           name of the absence alert rule
+//	.sourceAlert     name of the original alert rule
+//	.sourceAlerts    sorted names of all alert rules in the PrometheusRule that use the metric
+//	.metric          metric name
+//	.selector        selector for the metric, i.e. the metric name and retained label matchers
+//	.expr            absence alert rule expression according to the absence mode
+//	.range           range that is used with the 'over_time' absence mode
+//	.for             'for' duration according to the 'for' duration policy
+//	.severity        severity according to the severity map
+//	.sourceSeverity  severity of the original alert rule that .severity was mapped from
+//	.labels          labels that are retained from the original alert rule
+//	.metadata        annotations, labels, namespace, and name of the original PrometheusRule
+//
+// In addition to the builtin template functions, the 'quote' function can be used to
+// safely embed an arbitrary string in YAML and the 'join' function (strings.Join) can
+// be used to join a list of strings.
+type AbsenceRuleTemplate struct {
+	t *template.Template
+}
+
+var absenceRuleTemplateFuncs = template.FuncMap{
+	"join": strings.Join,
+	"quote": func(in any) (string, error) {
+		// JSON strings are valid YAML strings.
+		b, err := json.Marshal(fmt.Sprint(in))
+		return string(b), err
+	},
+}
+
+// ParseAbsenceRuleTemplate parses an AbsenceRuleTemplate from a template string.
+func ParseAbsenceRuleTemplate(tmplStr string) (*AbsenceRuleTemplate, error) {
+	t, err := template.New("absenceRule").Option("missingkey=error").Funcs(absenceRuleTemplateFuncs).Parse(tmplStr)
+	if err != nil {
+		return nil, err
+	}
+	return &AbsenceRuleTemplate{t}, nil
+}
+
+var defaultAbsenceRuleTemplate = func() *AbsenceRuleTemplate {
+	t, err := ParseAbsenceRuleTemplate(DefaultAbsenceRuleTemplate)
+	if err != nil {
+		panic(err.Error())
+	}
+	return t
+}()
+
+// renderedAbsenceRule is the expected structure of the output of an AbsenceRuleTemplate.
+type renderedAbsenceRule struct {
+	Expr        string                `json:"expr"`
+	For         monitoringv1.Duration `json:"for,omitempty"`
+	Labels      map[string]string     `json:"labels,omitempty"`
+	Annotations map[string]string     `json:"annotations,omitempty"`
+}
+
+// render executes the template with the given data and returns the resulting absence
+// alert rule. The alert name is taken from the data.
+func (t *AbsenceRuleTemplate) render(data map[string]any) (monitoringv1.Rule, error) {
+	var buf bytes.Buffer
+	if err := t.t.Execute(&buf, data); err != nil {
+		return monitoringv1.Rule{}, fmt.Errorf("could not render absence alert rule template: %w", err)
+	}
+
+	var rendered renderedAbsenceRule
+	if err := yaml.UnmarshalStrict(buf.Bytes(), &rendered); err != nil {
+		return monitoringv1.Rule{}, fmt.Errorf("could not parse rendered absence alert rule template: %w", err)
+	}
+	if rendered.Expr == "" {
+		return monitoringv1.Rule{}, errors.New("rendered absence alert rule template has an empty expr")
+	}
+	if _, err := parser.ParseExpr(rendered.Expr); err != nil {
+		return monitoringv1.Rule{}, fmt.Errorf("rendered absence alert rule template has an invalid expr %q: %w", rendered.Expr, err)
+	}
+
+	rule := monitoringv1.Rule{
+		Alert:       fmt.Sprint(data["alert"]),
+		Expr:        intstr.FromString(rendered.Expr),
+		Labels:      rendered.Labels,
+		Annotations: rendered.Annotations,
+	}
+	if rendered.For != "" {
+		if _, err := model.ParseDuration(string(rendered.For)); err != nil {
+			return monitoringv1.Rule{}, fmt.Errorf("rendered absence alert rule template has an invalid for duration %q: %w", rendered.For, err)
+		}
+		rule.For = &rendered.For
+	}
+	return rule, nil
+}
+
+// promRuleMetadata returns the vetted subset of PrometheusRule metadata that is passed
+// into templates.
+func promRuleMetadata(meta metav1.ObjectMeta) map[string]any {
+	return map[string]any{
+		"annotations": meta.Annotations,
+		"labels":      meta.Labels,
+		"namespace":   meta.Namespace,
+		"name":        meta.Name,
+	}
+}
@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+var _ = Describe("Absence alert rule template", func() {
+	logger := zap.New(zap.UseDevMode(true))
+	in := monitoringv1.Rule{
+		Alert: "LimesFooHigh",
+		Expr:  intstr.FromString(`limes_foo{region="a"} > 0`),
+		Labels: map[string]string{
+			"support_group": "containers",
+			"service":       "limes",
+			"severity":      "critical",
+		},
+	}
+	opts := RuleOptions{
+		KeepLabel: KeepLabel{LabelSupportGroup: true, LabelService: true},
+		PrometheusRule: metav1.ObjectMeta{
+			Name:      "openstack-limes-api.alerts",
+			Namespace: "resmgmt",
+			Labels:    map[string]string{"prometheus": "openstack"},
+		},
+	}
+
+	It("renders the same absence alert rule by default", func() {
+		actual, err := parseRule(logger, in, opts)
+		Expect(err).ToNot(HaveOccurred())
+		duration := monitoringv1.Duration("10m")
+		Expect(actual).To(Equal([]monitoringv1.Rule{{
+			Alert: "AbsentContainersLimesFoo",
+			Expr:  intstr.FromString(`absent(limes_foo)`),
+			For:   &duration,
+			Labels: map[string]string{
+				"context":       "absent-metrics",
+				"severity":      "info",
+				"support_group": "containers",
+				"service":       "limes",
+			},
+			Annotations: map[string]string{
+				"summary": "missing limes_foo",
+				"description": "The metric 'limes_foo' is missing. 'LimesFooHigh' alert using it may not fire as intended. " +
+					"See <https://github.com/sapcc/absent-metrics-operator/blob/master/docs/playbook.md|the operator playbook>.",
+				"source_alerts": `["LimesFooHigh"]`,
+			},
+		}}))
+	})
+
+	It("renders a custom template", func() {
+		tmpl, err := ParseAbsenceRuleTemplate(`
+expr: absent_over_time({{ .selector }}[{{ .range }}]) and on() vector(1)
+for: 1h
+labels:
+  context: absent-metrics
+  severity: warning
+  support_group: {{ quote .labels.support_group }}
+  playbook: {{ quote (printf "docs/%s/%s.md" .metadata.namespace .metric) }}
+annotations:
+  summary: {{ quote (printf "%s: %s is missing" .alert .selector) }}
+  description: {{ quote (printf "used by %s in %s" .sourceAlert .metadata.labels.prometheus) }}
+`)
+		Expect(err).ToNot(HaveOccurred())
+		o := opts
+		o.Template = tmpl
+		o.KeepLabelMatchers = true
+		actual, err := parseRule(logger, in, o)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(HaveLen(1))
+		Expect(actual[0].Alert).To(Equal("AbsentContainersLimesFooRegionA"))
+		Expect(actual[0].Expr.String()).To(Equal(`absent_over_time(limes_foo{region="a"}[1h]) and on() vector(1)`))
+		Expect(string(*actual[0].For)).To(Equal("1h"))
+		Expect(actual[0].Labels).To(Equal(map[string]string{
+			"context":       "absent-metrics",
+			"severity":      "warning",
+			"support_group": "containers",
+			"playbook":      "docs/resmgmt/limes_foo.md",
+		}))
+		Expect(actual[0].Annotations).To(Equal(map[string]string{
+			"summary":       `AbsentContainersLimesFooRegionA: limes_foo{region="a"} is missing`,
+			"description":   "used by LimesFooHigh in openstack",
+			"source_alerts": `["LimesFooHigh"]`,
+		}))
+	})
+
+	DescribeTable("Invalid templates",
+		func(tmplStr string) {
+			tmpl, err := ParseAbsenceRuleTemplate(tmplStr)
+			Expect(err).ToNot(HaveOccurred())
+			o := opts
+			o.Template = tmpl
+			_, err = parseRule(logger, in, o)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("reference to nonexistent data", `expr: {{ .doesntexist }}`),
+		Entry("unknown key", "expr: absent(foo)\nseverity: info"),
+		Entry("missing expr", `for: 10m`),
+		Entry("invalid expr", `expr: absent(foo`),
+		Entry("invalid for duration", "expr: absent(foo)\nfor: 10 minutes"),
+		Entry("invalid YAML", "expr: [absent(foo)"),
+	)
+})
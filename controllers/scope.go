@@ -0,0 +1,317 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Mode specifies whether absence alert rules are generated for PrometheusRules by
+// default.
+type Mode string
+
+// These are the valid values for Mode.
+const (
+	// ModeOptOut generates absence alert rules for all PrometheusRules unless the
+	// operator has been disabled for them.
+	ModeOptOut Mode = "opt-out"
+	// ModeOptIn only generates absence alert rules for PrometheusRules that have the
+	// 'absent-metrics-operator/enable' label or whose namespace has it.
+	ModeOptIn Mode = "opt-in"
+)
+
+// ParseMode parses a Mode from a string.
+func ParseMode(in string) (Mode, error) {
+	switch m := Mode(in); m {
+	case ModeOptOut, ModeOptIn:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid mode %q: expected %q or %q", in, ModeOptOut, ModeOptIn)
+	}
+}
+
+// optedIn returns true if the 'absent-metrics-operator/enable' label is set to 'true' on
+// a PrometheusRule with the given labels or, if the PrometheusRule does not have the
+// label, on its namespace.
+func optedIn(namespaceLabels, promRuleLabels map[string]string) bool {
+	if v, ok := promRuleLabels[labelOperatorEnable]; ok {
+		return parseBool(v)
+	}
+	return parseBool(namespaceLabels[labelOperatorEnable])
+}
+
+// promRuleOptedIn returns true if the given PrometheusRule has opted in to the generation
+// of absence alert rules. It always returns true in ModeOptOut.
+func (r *PrometheusRuleReconciler) promRuleOptedIn(
+	ctx context.Context,
+	promRule *monitoringv1.PrometheusRule,
+) (bool, error) {
+
+	if r.Mode != ModeOptIn {
+		return true, nil
+	}
+	if _, ok := promRule.Labels[labelOperatorEnable]; ok {
+		return optedIn(nil, promRule.Labels), nil
+	}
+	var ns corev1.Namespace
+	if err := r.Get(ctx, client.ObjectKey{Name: promRule.Namespace}, &ns); err != nil {
+		return false, err
+	}
+	return optedIn(ns.Labels, promRule.Labels), nil
+}
+
+// isEnabled returns true if absence alert rules are generated for the given
+// PrometheusRule, i.e. if the operator has not been disabled for it by the given
+// configuration and if it is in scope. The configuration already takes the Mode into
+// account, see promRuleConfig.
+func (r *PrometheusRuleReconciler) isEnabled(
+	ctx context.Context,
+	cfg promRuleConfig,
+	promRule *monitoringv1.PrometheusRule,
+) (bool, error) {
+
+	if cfg.disabled {
+		return false, nil
+	}
+	return r.promRuleInScope(ctx, promRule)
+}
+
+// Scope restricts the PrometheusRules that the operator generates absence alert rules
+// for. The zero value does not restrict anything.
+type Scope struct {
+	// Namespaces is the list of namespaces that are watched. All namespaces are watched
+	// if it is empty.
+	Namespaces []string
+	// NamespaceSelector selects the namespaces by their labels. It is evaluated for each
+	// reconciliation so that changes to the labels of a namespace are picked up.
+	NamespaceSelector labels.Selector
+	// SelectedNamespaces are the namespaces that matched the NamespaceSelector when the
+	// cache was set up, see SelectNamespaces. If it is not nil then the cache only holds
+	// the objects in these namespaces and it has to be set up again when another
+	// namespace matches the NamespaceSelector or one of them no longer does.
+	SelectedNamespaces []string
+	// PrometheusRuleSelector selects the PrometheusRules by their labels.
+	PrometheusRuleSelector labels.Selector
+}
+
+// IsRestricted returns true if the scope restricts the PrometheusRules in any way.
+func (s Scope) IsRestricted() bool {
+	return len(s.Namespaces) > 0 || s.NamespaceSelector != nil || s.PrometheusRuleSelector != nil
+}
+
+// copiedLabels returns the label keys that are copied from a PrometheusRule to its
+// AbsencePrometheusRule, so that the AbsencePrometheusRule also matches the
+// PrometheusRuleSelector. Otherwise it would not be cached.
+func (s Scope) copiedLabels() []string {
+	if s.PrometheusRuleSelector == nil {
+		return nil
+	}
+	reqs, _ := s.PrometheusRuleSelector.Requirements()
+	var result []string
+	for _, req := range reqs {
+		switch req.Operator() {
+		case selection.Equals, selection.DoubleEquals, selection.In, selection.Exists:
+			result = append(result, req.Key())
+		}
+	}
+	return result
+}
+
+// matchesPrometheusRule returns true if the given PrometheusRule matches the
+// PrometheusRuleSelector and is in one of the Namespaces. The NamespaceSelector is
+// checked separately by matchesNamespaceLabels.
+func (s Scope) matchesPrometheusRule(promRule *monitoringv1.PrometheusRule) bool {
+	sel := s.PrometheusRuleSelector
+	if sel != nil && !sel.Matches(labels.Set(promRule.Labels)) {
+		return false
+	}
+	return len(s.Namespaces) == 0 || slices.Contains(s.Namespaces, promRule.Namespace)
+}
+
+// matchesNamespaceLabels returns true if a namespace with the given labels matches the
+// NamespaceSelector.
+func (s Scope) matchesNamespaceLabels(namespaceLabels map[string]string) bool {
+	return s.NamespaceSelector == nil || s.NamespaceSelector.Matches(labels.Set(namespaceLabels))
+}
+
+// SelectNamespaces returns the names of the namespaces that match the NamespaceSelector
+// and, if Namespaces is not empty, are also part of it. The result is never nil.
+func (s Scope) SelectNamespaces(ctx context.Context, c client.Reader) ([]string, error) {
+	var namespaces corev1.NamespaceList
+	err := c.List(ctx, &namespaces, client.MatchingLabelsSelector{Selector: s.NamespaceSelector})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(namespaces.Items))
+	for _, ns := range namespaces.Items {
+		if len(s.Namespaces) == 0 || slices.Contains(s.Namespaces, ns.Name) {
+			result = append(result, ns.Name)
+		}
+	}
+	return result, nil
+}
+
+// namespaceSelectionChanged returns true if the given namespace started or stopped
+// matching the NamespaceSelector since the SelectedNamespaces were determined.
+func (s Scope) namespaceSelectionChanged(ns client.Object) bool {
+	matches := (len(s.Namespaces) == 0 || slices.Contains(s.Namespaces, ns.GetName())) &&
+		s.matchesNamespaceLabels(ns.GetLabels())
+	return matches != slices.Contains(s.SelectedNamespaces, ns.GetName())
+}
+
+// promRuleInScope returns true if the given PrometheusRule is in scope.
+//
+// The cache only holds the PrometheusRules that match the PrometheusRuleSelector but a
+// PrometheusRule is also checked here in case that the cache is not restricted.
+func (r *PrometheusRuleReconciler) promRuleInScope(
+	ctx context.Context,
+	promRule *monitoringv1.PrometheusRule,
+) (bool, error) {
+
+	if !r.Scope.matchesPrometheusRule(promRule) {
+		return false, nil
+	}
+	if r.Scope.NamespaceSelector == nil {
+		return true, nil
+	}
+	var ns corev1.Namespace
+	if err := r.Get(ctx, client.ObjectKey{Name: promRule.Namespace}, &ns); err != nil {
+		return false, err
+	}
+	return r.Scope.matchesNamespaceLabels(ns.Labels), nil
+}
+
+// copyScopeLabels copies the labels that are required by the PrometheusRuleSelector from
+// the given PrometheusRule to the AbsencePrometheusRule, unless they are already present.
+func (r *PrometheusRuleReconciler) copyScopeLabels(absencePromRule, promRule *monitoringv1.PrometheusRule) {
+	for _, k := range r.Scope.copiedLabels() {
+		v, ok := promRule.Labels[k]
+		if !ok {
+			continue
+		}
+		if _, exists := absencePromRule.Labels[k]; exists {
+			continue
+		}
+		if absencePromRule.Labels == nil {
+			absencePromRule.Labels = make(map[string]string)
+		}
+		absencePromRule.Labels[k] = v
+	}
+}
+
+// handleOutOfScope is called when a PrometheusRule could not be found in the cache. If it
+// still exists then it has fallen out of the scope of the cache, e.g. because its labels
+// were changed, and the finalizer and the status annotations are removed from it.
+func (r *PrometheusRuleReconciler) handleOutOfScope(ctx context.Context, key types.NamespacedName) error {
+	if r.APIReader == nil || !r.Scope.IsRestricted() {
+		return nil
+	}
+	var promRule monitoringv1.PrometheusRule
+	if err := r.APIReader.Get(ctx, key, &promRule); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	r.clearStatus(ctx, &promRule)
+	return r.updateFinalizer(ctx, &promRule, false)
+}
+
+// enqueuePrometheusRulesInChangedNamespace returns reconcile requests for all
+// PrometheusRules in a namespace whose labels were changed, since it could have fallen in
+// or out of the scope of the NamespaceSelector or opted in or out in ModeOptIn.
+func (r *PrometheusRuleReconciler) enqueuePrometheusRulesInChangedNamespace(
+	ctx context.Context,
+	obj client.Object,
+) []reconcile.Request {
+
+	return r.enqueuePrometheusRules(ctx, client.InNamespace(obj.GetName()))
+}
+
+// namespaceLabelsChanged is a predicate that only lets through label changes of
+// namespaces.
+var namespaceLabelsChanged = predicate.Funcs{
+	CreateFunc:  func(event.CreateEvent) bool { return false },
+	DeleteFunc:  func(event.DeleteEvent) bool { return false },
+	GenericFunc: func(event.GenericEvent) bool { return false },
+	UpdateFunc:  predicate.LabelChangedPredicate{}.Update,
+}
+
+// CleanUpOutOfScope removes absence alert rules for PrometheusRules that are not in
+// scope, e.g. after the operator was restarted with a different scope. It also removes
+// the finalizer from these PrometheusRules.
+//
+// Since the cache only holds the objects that are in scope, the API server is queried
+// directly. This is meant to be run once on startup.
+func (r *PrometheusRuleReconciler) CleanUpOutOfScope(ctx context.Context) error {
+	if r.APIReader == nil || !r.Scope.IsRestricted() {
+		return nil
+	}
+
+	var absencePromRules monitoringv1.PrometheusRuleList
+	err := r.APIReader.List(ctx, &absencePromRules, client.HasLabels{labelOperatorManagedBy})
+	if err != nil {
+		return err
+	}
+	for _, aPR := range absencePromRules.Items {
+		if !parseBool(aPR.Labels[labelOperatorManagedBy]) {
+			continue
+		}
+		sources := getRuleGroupSources(&aPR)
+		var outOfScope []string
+		for _, src := range sources {
+			if slices.Contains(outOfScope, src.Name) {
+				continue
+			}
+			key := types.NamespacedName{Namespace: aPR.Namespace, Name: src.Name}
+			var promRule monitoringv1.PrometheusRule
+			err := r.APIReader.Get(ctx, key, &promRule)
+			switch {
+			case apierrors.IsNotFound(err):
+				// This is handled by cleanUpAbsencePrometheusRule.
+				continue
+			case err != nil:
+				return err
+			}
+			ok, err := r.promRuleInScope(ctx, &promRule)
+			if err != nil {
+				return err
+			}
+			if ok {
+				continue
+			}
+			outOfScope = append(outOfScope, src.Name)
+			r.clearStatus(ctx, &promRule)
+			if err := r.updateFinalizer(ctx, &promRule, false); err != nil {
+				return err
+			}
+		}
+		if len(outOfScope) == 0 {
+			continue
+		}
+
+		r.Log.Info("cleaning up absence alert rules for PrometheusRules that are out of scope",
+			"AbsencePrometheusRule", aPR.Namespace+"/"+aPR.Name, "PrometheusRules", outOfScope)
+		var newRuleGroups []monitoringv1.RuleGroup
+		for _, g := range aPR.Spec.Groups {
+			if !slices.Contains(outOfScope, sources[g.Name].Name) {
+				newRuleGroups = append(newRuleGroups, g)
+			}
+		}
+		if err := r.removeOrphanedRuleGroups(ctx, &aPR, newRuleGroups, sources); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var _ = Describe("Scope", func() {
+	It("does not restrict anything by default", func() {
+		var s Scope
+		Expect(s.IsRestricted()).To(BeFalse())
+		Expect(s.copiedLabels()).To(BeEmpty())
+	})
+
+	It("copies the labels that are required by the PrometheusRule selector", func() {
+		sel, err := labels.Parse("team=foo,tier in (backend),monitored,env!=qa,!legacy")
+		Expect(err).ToNot(HaveOccurred())
+		s := Scope{PrometheusRuleSelector: sel}
+		Expect(s.IsRestricted()).To(BeTrue())
+		Expect(s.copiedLabels()).To(ConsistOf("team", "tier", "monitored"))
+
+		r := &PrometheusRuleReconciler{Scope: s}
+		promRule := &monitoringv1.PrometheusRule{ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"team": "foo", "tier": "backend", "env": "prod"},
+		}}
+		aPR := &monitoringv1.PrometheusRule{ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"tier": "frontend"},
+		}}
+		r.copyScopeLabels(aPR, promRule)
+		// Existing labels are not overwritten.
+		Expect(aPR.Labels).To(Equal(map[string]string{"team": "foo", "tier": "frontend"}))
+	})
+
+	It("parses the mode", func() {
+		Expect(ParseMode("opt-in")).To(Equal(ModeOptIn))
+		Expect(ParseMode("opt-out")).To(Equal(ModeOptOut))
+		_, err := ParseMode("optin")
+		Expect(err).To(HaveOccurred())
+	})
+
+	DescribeTable("Opting in",
+		func(namespaceLabel, promRuleLabel string, expected bool) {
+			label := func(v string) map[string]string {
+				if v == "" {
+					return nil
+				}
+				return map[string]string{labelOperatorEnable: v}
+			}
+			Expect(optedIn(label(namespaceLabel), label(promRuleLabel))).To(Equal(expected))
+		},
+		Entry("without labels", "", "", false),
+		Entry("by namespace", "true", "", true),
+		Entry("by PrometheusRule", "", "true", true),
+		Entry("by namespace and opted out by PrometheusRule", "true", "false", false),
+		Entry("by PrometheusRule in a namespace that opted out", "false", "true", true),
+	)
+
+	It("does not require a PrometheusRule to opt in by default", func() {
+		r := &PrometheusRuleReconciler{}
+		ok, err := r.promRuleOptedIn(context.Background(), &monitoringv1.PrometheusRule{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeTrue())
+
+		r.Mode = ModeOptIn
+		ok, err = r.promRuleOptedIn(context.Background(), &monitoringv1.PrometheusRule{ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{labelOperatorEnable: "true"},
+		}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeTrue())
+	})
+
+	It("detects when a namespace starts or stops matching the namespace selector", func() {
+		sel, err := labels.Parse("team=foo")
+		Expect(err).ToNot(HaveOccurred())
+		s := Scope{
+			Namespaces:         []string{"resmgmt", "swift"},
+			NamespaceSelector:  sel,
+			SelectedNamespaces: []string{"resmgmt"},
+		}
+		namespace := func(name, team string) *corev1.Namespace {
+			return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{"team": team},
+			}}
+		}
+
+		Expect(s.namespaceSelectionChanged(namespace("resmgmt", "foo"))).To(BeFalse())
+		Expect(s.namespaceSelectionChanged(namespace("resmgmt", "bar"))).To(BeTrue())
+		Expect(s.namespaceSelectionChanged(namespace("swift", "bar"))).To(BeFalse())
+		Expect(s.namespaceSelectionChanged(namespace("swift", "foo"))).To(BeTrue())
+		// Namespaces that are not watched are never selected.
+		Expect(s.namespaceSelectionChanged(namespace("keppel", "foo"))).To(BeFalse())
+	})
+
+	It("checks whether a PrometheusRule is in scope", func() {
+		sel, err := labels.Parse("team=foo")
+		Expect(err).ToNot(HaveOccurred())
+		r := &PrometheusRuleReconciler{Scope: Scope{
+			Namespaces:             []string{"resmgmt"},
+			PrometheusRuleSelector: sel,
+		}}
+		promRule := func(namespace, team string) *monitoringv1.PrometheusRule {
+			return &monitoringv1.PrometheusRule{ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Labels:    map[string]string{"team": team},
+			}}
+		}
+
+		ctx := context.Background()
+		for _, tc := range []struct {
+			promRule *monitoringv1.PrometheusRule
+			expected bool
+		}{
+			{promRule("resmgmt", "foo"), true},
+			{promRule("resmgmt", "bar"), false},
+			{promRule("swift", "foo"), false},
+		} {
+			ok, err := r.promRuleInScope(ctx, tc.promRule)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(Equal(tc.expected))
+		}
+	})
+})
@@ -0,0 +1,180 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"slices"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ruleGroupSource identifies the PrometheusRule that an AbsenceRuleGroup was generated
+// for. The UID distinguishes a PrometheusRule from an earlier one with the same name
+// that has since been deleted and recreated.
+type ruleGroupSource struct {
+	Name string    `json:"name"`
+	UID  types.UID `json:"uid,omitempty"`
+}
+
+// isFrom returns true if the given PrometheusRule is this source. The UID is only
+// compared if both are known, i.e. sources that were derived from the name of an
+// AbsenceRuleGroup match any PrometheusRule with the same name.
+func (s ruleGroupSource) isFrom(promRule metav1.Object) bool {
+	if s.Name != promRule.GetName() {
+		return false
+	}
+	return s.UID == "" || promRule.GetUID() == "" || s.UID == promRule.GetUID()
+}
+
+// ruleGroupSources maps the names of the AbsenceRuleGroups in an AbsencePrometheusRule to
+// their source PrometheusRule. It is stored in the annotationRuleGroupSources of the
+// AbsencePrometheusRule.
+type ruleGroupSources map[string]ruleGroupSource
+
+// getRuleGroupSources returns the sources of the AbsenceRuleGroups in the given
+// AbsencePrometheusRule.
+//
+// AbsencePrometheusRules that were created by an older version of the operator don't
+// have the annotationRuleGroupSources. For these, the source is derived from the name of
+// the AbsenceRuleGroup instead. The annotation is added the next time that the
+// AbsencePrometheusRule is updated.
+func getRuleGroupSources(absencePromRule *monitoringv1.PrometheusRule) ruleGroupSources {
+	var recorded ruleGroupSources
+	if v, ok := absencePromRule.Annotations[annotationRuleGroupSources]; ok {
+		// An invalid annotation is treated like a missing one.
+		_ = json.Unmarshal([]byte(v), &recorded)
+	}
+
+	result := make(ruleGroupSources, len(absencePromRule.Spec.Groups))
+	for _, g := range absencePromRule.Spec.Groups {
+		if src, ok := recorded[g.Name]; ok {
+			result[g.Name] = src
+		} else if n := promRulefromAbsenceRuleGroupName(g.Name); n != "" {
+			result[g.Name] = ruleGroupSource{Name: n}
+		}
+	}
+	return result
+}
+
+// setRuleGroupSources records the sources of the AbsenceRuleGroups in the given
+// AbsencePrometheusRule. Sources for AbsenceRuleGroups that no longer exist are dropped.
+func setRuleGroupSources(absencePromRule *monitoringv1.PrometheusRule, sources ruleGroupSources) {
+	recorded := make(ruleGroupSources, len(absencePromRule.Spec.Groups))
+	for _, g := range absencePromRule.Spec.Groups {
+		if src, ok := sources[g.Name]; ok {
+			recorded[g.Name] = src
+		}
+	}
+	// Map keys are sorted by json.Marshal so the annotation is stable.
+	buf, err := json.Marshal(recorded)
+	if err != nil {
+		return
+	}
+	if absencePromRule.Annotations == nil {
+		absencePromRule.Annotations = make(map[string]string)
+	}
+	absencePromRule.Annotations[annotationRuleGroupSources] = string(buf)
+}
+
+// add records the given PrometheusRule as the source of the given AbsenceRuleGroups.
+func (s ruleGroupSources) add(promRule *monitoringv1.PrometheusRule, groups []monitoringv1.RuleGroup) {
+	for _, g := range groups {
+		s[g.Name] = ruleGroupSource{Name: promRule.GetName(), UID: promRule.GetUID()}
+	}
+}
+
+// enqueueSourcePrometheusRules returns reconcile requests for the PrometheusRules that
+// the AbsenceRuleGroups in the given AbsencePrometheusRule were generated for. It is used
+// to repair manual changes to an AbsencePrometheusRule, including its deletion.
+func (r *PrometheusRuleReconciler) enqueueSourcePrometheusRules(_ context.Context, obj client.Object) []reconcile.Request {
+	absencePromRule, ok := obj.(*monitoringv1.PrometheusRule)
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, src := range getRuleGroupSources(absencePromRule) {
+		names = append(names, src.Name)
+	}
+	slices.Sort(names)
+
+	var result []reconcile.Request
+	for _, n := range slices.Compact(names) {
+		result = append(result, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: absencePromRule.GetNamespace(), Name: n},
+		})
+	}
+	return result
+}
+
+// changedByOthers filters out the events for AbsencePrometheusRules that were caused by
+// the operator's own writes, so that creating or updating an AbsencePrometheusRule does
+// not requeue its source PrometheusRules. Whether a change was made by the operator is
+// determined from the managedFields: an update is ignored if only the entries of the
+// operator's fieldManager have changed. Deletions are never ignored since the
+// managedFields don't tell who deleted an object.
+var changedByOthers = predicate.Funcs{
+	CreateFunc: func(e event.CreateEvent) bool {
+		return e.Object == nil || !isOnlyManagedByOperator(e.Object.GetManagedFields())
+	},
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		if e.ObjectOld == nil || e.ObjectNew == nil {
+			return true
+		}
+		if e.ObjectOld.GetResourceVersion() == e.ObjectNew.GetResourceVersion() {
+			// Periodic resync.
+			return false
+		}
+		changed := changedManagedFields(e.ObjectOld.GetManagedFields(), e.ObjectNew.GetManagedFields())
+		// If the managedFields have not changed then we can't tell who made the change.
+		return len(changed) == 0 || !isOnlyManagedByOperator(changed)
+	},
+}
+
+// isOnlyManagedByOperator returns true if all of the given managedFields entries belong
+// to the operator's fieldManager.
+func isOnlyManagedByOperator(entries []metav1.ManagedFieldsEntry) bool {
+	if len(entries) == 0 {
+		return false
+	}
+	for _, e := range entries {
+		if e.Manager != fieldManager {
+			return false
+		}
+	}
+	return true
+}
+
+// changedManagedFields returns the managedFields entries of the new object that are not
+// present in the same form in the old object.
+func changedManagedFields(oldEntries, newEntries []metav1.ManagedFieldsEntry) []metav1.ManagedFieldsEntry {
+	var result []metav1.ManagedFieldsEntry
+	for _, e := range newEntries {
+		if !slices.ContainsFunc(oldEntries, func(o metav1.ManagedFieldsEntry) bool { return reflect.DeepEqual(o, e) }) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// isRepairableAbsencePrometheusRule returns true if the given object is an
+// AbsencePrometheusRule that is not manually overridden.
+func isRepairableAbsencePrometheusRule(obj client.Object) bool {
+	return parseBool(obj.GetLabels()[labelOperatorManagedBy]) && !hasManualOverride(obj)
+}
+
+// hasManualOverride returns true if the given AbsencePrometheusRule has the
+// 'absent-metrics-operator/manual-override' annotation. The operator leaves such an
+// AbsencePrometheusRule as is, so that it can be changed manually.
+func hasManualOverride(obj client.Object) bool {
+	return parseBool(obj.GetAnnotations()[annotationManualOverride])
+}
@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Rule group sources", func() {
+	groups := func(names ...string) []monitoringv1.RuleGroup {
+		result := make([]monitoringv1.RuleGroup, 0, len(names))
+		for _, n := range names {
+			result = append(result, monitoringv1.RuleGroup{Name: n})
+		}
+		return result
+	}
+	promRule := &monitoringv1.PrometheusRule{ObjectMeta: metav1.ObjectMeta{
+		Name: "foo",
+		UID:  "8a4c2f5e-6f2a-4b8e-9d6c-3b1f0e7a9c21",
+	}}
+
+	It("derives the sources of legacy AbsencePrometheusRules from the rule group names", func() {
+		aPR := &monitoringv1.PrometheusRule{
+			Spec: monitoringv1.PrometheusRuleSpec{Groups: groups("foo/api.alerts", "foo-extra/team/api.alerts", "invalid")},
+		}
+		Expect(getRuleGroupSources(aPR)).To(Equal(ruleGroupSources{
+			"foo/api.alerts":            {Name: "foo"},
+			"foo-extra/team/api.alerts": {Name: "foo-extra"},
+		}))
+	})
+
+	It("records the sources in an annotation", func() {
+		aPR := &monitoringv1.PrometheusRule{
+			Spec: monitoringv1.PrometheusRuleSpec{Groups: groups("foo/api.alerts", "foo-extra/api.alerts")},
+		}
+		sources := getRuleGroupSources(aPR)
+		sources.add(promRule, groups("foo/api.alerts", "foo/other.alerts"))
+		setRuleGroupSources(aPR, sources)
+		// Sources for rule groups that are not in the AbsencePrometheusRule are dropped.
+		Expect(aPR.Annotations).To(HaveKeyWithValue(annotationRuleGroupSources,
+			`{"foo-extra/api.alerts":{"name":"foo-extra"},"foo/api.alerts":{"name":"foo","uid":"8a4c2f5e-6f2a-4b8e-9d6c-3b1f0e7a9c21"}}`))
+
+		// The annotation takes precedence over the rule group names.
+		aPR.Annotations[annotationRuleGroupSources] = `{"foo/api.alerts":{"name":"bar"}}`
+		Expect(getRuleGroupSources(aPR)).To(Equal(ruleGroupSources{
+			"foo/api.alerts":       {Name: "bar"},
+			"foo-extra/api.alerts": {Name: "foo-extra"},
+		}))
+	})
+
+	It("compares the UID of a source only if it is known", func() {
+		recreated := promRule.DeepCopy()
+		recreated.UID = "3f6b1d2c-9e4a-4c7b-8f1e-2a5d6c7b8e90"
+
+		src := ruleGroupSource{Name: "foo", UID: promRule.UID}
+		Expect(src.isFrom(promRule)).To(BeTrue())
+		Expect(src.isFrom(recreated)).To(BeFalse())
+		Expect(src.isFrom(&monitoringv1.PrometheusRule{ObjectMeta: metav1.ObjectMeta{Name: "foo"}})).To(BeTrue())
+		Expect(src.isFrom(&monitoringv1.PrometheusRule{ObjectMeta: metav1.ObjectMeta{Name: "bar", UID: promRule.UID}})).To(BeFalse())
+
+		// Sources of legacy AbsencePrometheusRules match by name.
+		Expect(ruleGroupSource{Name: "foo"}.isFrom(recreated)).To(BeTrue())
+	})
+
+	It("enqueues the source PrometheusRules of an AbsencePrometheusRule", func() {
+		aPR := &monitoringv1.PrometheusRule{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "openstack-absent-metric-alert-rules",
+				Namespace: "resmgmt",
+				Labels:    map[string]string{labelOperatorManagedBy: "true"},
+			},
+			Spec: monitoringv1.PrometheusRuleSpec{Groups: groups("foo/api.alerts", "foo/other.alerts", "bar/api.alerts")},
+		}
+		r := &PrometheusRuleReconciler{}
+		Expect(r.enqueueSourcePrometheusRules(context.Background(), aPR)).To(Equal([]reconcile.Request{
+			{NamespacedName: types.NamespacedName{Namespace: "resmgmt", Name: "bar"}},
+			{NamespacedName: types.NamespacedName{Namespace: "resmgmt", Name: "foo"}},
+		}))
+		Expect(isRepairableAbsencePrometheusRule(aPR)).To(BeTrue())
+
+		aPR.Annotations = map[string]string{annotationManualOverride: "true"}
+		Expect(isRepairableAbsencePrometheusRule(aPR)).To(BeFalse())
+		Expect(isRepairableAbsencePrometheusRule(promRule)).To(BeFalse())
+	})
+
+	It("ignores the operator's own changes to AbsencePrometheusRules", func() {
+		entry := func(manager string, sec int) metav1.ManagedFieldsEntry {
+			t := metav1.Unix(int64(sec), 0)
+			return metav1.ManagedFieldsEntry{Manager: manager, Operation: metav1.ManagedFieldsOperationApply, Time: &t}
+		}
+		aPR := func(resourceVersion string, entries ...metav1.ManagedFieldsEntry) *monitoringv1.PrometheusRule {
+			return &monitoringv1.PrometheusRule{ObjectMeta: metav1.ObjectMeta{
+				ResourceVersion: resourceVersion,
+				ManagedFields:   entries,
+			}}
+		}
+
+		Expect(changedByOthers.Create(event.CreateEvent{Object: aPR("1", entry(fieldManager, 1))})).To(BeFalse())
+		Expect(changedByOthers.Create(event.CreateEvent{Object: aPR("1", entry("kubectl", 1))})).To(BeTrue())
+
+		old := aPR("1", entry(fieldManager, 1))
+		Expect(changedByOthers.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: old})).To(BeFalse())
+		Expect(changedByOthers.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: aPR("2", entry(fieldManager, 2))})).To(BeFalse())
+		Expect(changedByOthers.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: aPR("2", entry(fieldManager, 1), entry("kubectl", 2))})).To(BeTrue())
+		// The operator taking over the fields of another manager is its own change.
+		Expect(changedByOthers.Update(event.UpdateEvent{
+			ObjectOld: aPR("2", entry(fieldManager, 1), entry("kubectl", 2)),
+			ObjectNew: aPR("3", entry(fieldManager, 3)),
+		})).To(BeFalse())
+		// Changes that can't be attributed are not ignored.
+		Expect(changedByOthers.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: aPR("2", entry(fieldManager, 1))})).To(BeTrue())
+		Expect(changedByOthers.Delete(event.DeleteEvent{Object: old})).To(BeTrue())
+	})
+
+	It("only replaces the rule groups of the given PrometheusRule when merging", func() {
+		existing := groups("foo/api.alerts", "foo/old.alerts", "foo-extra/api.alerts")
+		sources := getRuleGroupSources(&monitoringv1.PrometheusRule{Spec: monitoringv1.PrometheusRuleSpec{Groups: existing}})
+		Expect(mergeAbsenceRuleGroups("foo", sources, existing, groups("foo/api.alerts"))).
+			To(Equal(groups("foo/api.alerts", "foo-extra/api.alerts")))
+
+		// The rule groups of an earlier PrometheusRule with the same name are replaced too.
+		sources["foo/old.alerts"] = ruleGroupSource{Name: "foo", UID: "3f6b1d2c-9e4a-4c7b-8f1e-2a5d6c7b8e90"}
+		Expect(mergeAbsenceRuleGroups("foo", sources, existing, groups("foo/api.alerts"))).
+			To(Equal(groups("foo/api.alerts", "foo-extra/api.alerts")))
+	})
+})
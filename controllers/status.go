@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/sapcc/go-bits/errext"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// statusRefreshInterval is the interval after which the last successful reconcile time
+// in the status annotations of a PrometheusRule is refreshed, if nothing else changed.
+// We don't refresh it on every reconciliation to avoid writing to the PrometheusRule
+// every requeueInterval.
+var statusRefreshInterval = 1 * time.Hour
+
+// promRuleStatus is the result of reconciling a PrometheusRule.
+type promRuleStatus struct {
+	// absencePromRule is the name of the AbsencePrometheusRule that holds the absence
+	// alert rules for the PrometheusRule.
+	absencePromRule string
+	// absenceRules is the number of absence alert rules that were generated for the
+	// PrometheusRule.
+	absenceRules int
+}
+
+// reportStatus writes the result of reconciling a PrometheusRule back to it using the
+// status annotations.
+//
+// If reconcileErr is a ruleGroupParseError then it is recorded in the status and the
+// rest of the status is left as is. Other errors are transient and are not recorded.
+func (r *PrometheusRuleReconciler) reportStatus(ctx context.Context, promRule *monitoringv1.PrometheusRule, status promRuleStatus, reconcileErr error) {
+	now := time.Now()
+	if IsTest {
+		now = time.Unix(1, 0)
+	}
+	if a, ok := statusAnnotations(promRule.GetAnnotations(), status, reconcileErr, now); ok {
+		r.patchStatusAnnotations(ctx, promRule, a)
+	}
+}
+
+// statusAnnotations returns the annotations of a PrometheusRule with updated status
+// annotations. It returns false if the status should be left as is.
+func statusAnnotations(annotations map[string]string, status promRuleStatus, reconcileErr error, now time.Time) (map[string]string, bool) {
+	a := maps.Clone(annotations)
+	if a == nil {
+		a = make(map[string]string)
+	}
+	switch perr, isParseErr := errext.As[*ruleGroupParseError](reconcileErr); {
+	case reconcileErr == nil:
+		delete(a, annotationStatusError)
+		if status.absenceRules > 0 {
+			a[annotationStatusAbsencePromRule] = status.absencePromRule
+		} else {
+			delete(a, annotationStatusAbsencePromRule)
+		}
+		a[annotationStatusAbsenceRules] = strconv.Itoa(status.absenceRules)
+
+		// Only refresh the last successful reconcile time if something else has changed
+		// or if it has become stale.
+		lastSuccess, err := time.Parse(time.RFC3339, a[annotationStatusLastSuccess])
+		if err != nil || !maps.Equal(a, annotations) || now.Sub(lastSuccess) >= statusRefreshInterval {
+			a[annotationStatusLastSuccess] = now.UTC().Format(time.RFC3339)
+		}
+	case isParseErr:
+		a[annotationStatusError] = perr.Error()
+	default:
+		return nil, false
+	}
+	return a, true
+}
+
+// clearStatus removes the status annotations from a PrometheusRule. It is used when the
+// operator has been disabled for the PrometheusRule.
+func (r *PrometheusRuleReconciler) clearStatus(ctx context.Context, promRule *monitoringv1.PrometheusRule) {
+	a := maps.Clone(promRule.GetAnnotations())
+	maps.DeleteFunc(a, func(k, _ string) bool { return isStatusAnnotation(k) })
+	r.patchStatusAnnotations(ctx, promRule, a)
+}
+
+func (r *PrometheusRuleReconciler) patchStatusAnnotations(ctx context.Context, promRule *monitoringv1.PrometheusRule, annotations map[string]string) {
+	if r.DryRun || maps.Equal(annotations, promRule.GetAnnotations()) {
+		return
+	}
+	unmodified := promRule.DeepCopy()
+	promRule.SetAnnotations(annotations)
+	if err := r.Patch(ctx, promRule, client.MergeFrom(unmodified)); err != nil {
+		// We choose to absorb the error here since the status is written again on the
+		// next reconciliation.
+		r.Log.Error(err, "could not update status annotations of PrometheusRule",
+			"name", promRule.GetName(), "namespace", promRule.GetNamespace())
+	}
+}
+
+func isStatusAnnotation(key string) bool {
+	return strings.HasPrefix(key, annotationStatusPrefix)
+}
+
+// ignoreStatusUpdates is a predicate that filters out update events for changes to
+// the status annotations of a PrometheusRule. Otherwise writing the status would
+// trigger another reconciliation.
+var ignoreStatusUpdates = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		if e.ObjectOld == nil || e.ObjectNew == nil {
+			return true
+		}
+		if e.ObjectOld.GetGeneration() != e.ObjectNew.GetGeneration() ||
+			!e.ObjectOld.GetDeletionTimestamp().Equal(e.ObjectNew.GetDeletionTimestamp()) ||
+			!maps.Equal(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels()) {
+			return true
+		}
+		withoutStatus := func(in map[string]string) map[string]string {
+			out := maps.Clone(in)
+			maps.DeleteFunc(out, func(k, _ string) bool { return isStatusAnnotation(k) })
+			return out
+		}
+		return !maps.Equal(withoutStatus(e.ObjectOld.GetAnnotations()), withoutStatus(e.ObjectNew.GetAnnotations()))
+	},
+}
@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("Status", func() {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	status := promRuleStatus{absencePromRule: "openstack-absent-metric-alert-rules", absenceRules: 3}
+
+	It("records a successful reconciliation", func() {
+		a, ok := statusAnnotations(map[string]string{"foo": "bar"}, status, nil, now)
+		Expect(ok).To(BeTrue())
+		Expect(a).To(Equal(map[string]string{
+			"foo": "bar",
+			"status.absent-metrics-operator/absence-prometheusrule": "openstack-absent-metric-alert-rules",
+			"status.absent-metrics-operator/absence-rules":          "3",
+			"status.absent-metrics-operator/last-success":           "2025-01-01T12:00:00Z",
+		}))
+
+		// The last successful reconcile time is only refreshed if something changed or if
+		// it is stale.
+		b, ok := statusAnnotations(a, status, nil, now.Add(10*time.Minute))
+		Expect(ok).To(BeTrue())
+		Expect(b).To(Equal(a))
+		b, ok = statusAnnotations(a, status, nil, now.Add(statusRefreshInterval))
+		Expect(ok).To(BeTrue())
+		Expect(b).To(HaveKeyWithValue(annotationStatusLastSuccess, "2025-01-01T13:00:00Z"))
+		b, ok = statusAnnotations(a, promRuleStatus{}, nil, now.Add(10*time.Minute))
+		Expect(ok).To(BeTrue())
+		Expect(b).ToNot(HaveKey(annotationStatusAbsencePromRule))
+		Expect(b).To(HaveKeyWithValue(annotationStatusAbsenceRules, "0"))
+		Expect(b).To(HaveKeyWithValue(annotationStatusLastSuccess, "2025-01-01T12:10:00Z"))
+	})
+
+	It("records parse errors with the offending rule group and alert rule", func() {
+		a, _ := statusAnnotations(nil, status, nil, now)
+		perr := &ruleGroupParseError{cause: errors.New("boom"), group: "limes.alerts", rule: "LimesFooHigh"}
+		b, ok := statusAnnotations(a, promRuleStatus{}, perr, now.Add(10*time.Minute))
+		Expect(ok).To(BeTrue())
+		Expect(b).To(HaveKeyWithValue(annotationStatusError, `rule group "limes.alerts", alert rule "LimesFooHigh": boom`))
+		Expect(b).To(HaveKeyWithValue(annotationStatusAbsenceRules, "3"))
+		Expect(b).To(HaveKeyWithValue(annotationStatusLastSuccess, "2025-01-01T12:00:00Z"))
+
+		// The error is removed after the next successful reconciliation.
+		c, ok := statusAnnotations(b, status, nil, now.Add(20*time.Minute))
+		Expect(ok).To(BeTrue())
+		Expect(c).ToNot(HaveKey(annotationStatusError))
+		Expect(c).To(HaveKeyWithValue(annotationStatusLastSuccess, "2025-01-01T12:20:00Z"))
+	})
+
+	It("does not record transient errors", func() {
+		_, ok := statusAnnotations(nil, status, errors.New("connection refused"), now)
+		Expect(ok).To(BeFalse())
+	})
+
+	DescribeTable("Ignoring status updates",
+		func(mutate func(pr *monitoringv1.PrometheusRule), expected bool) {
+			old := &monitoringv1.PrometheusRule{ObjectMeta: metav1.ObjectMeta{
+				Generation:  1,
+				Labels:      map[string]string{"prometheus": "openstack"},
+				Annotations: map[string]string{"foo": "bar", annotationStatusAbsenceRules: "1"},
+			}}
+			updated := old.DeepCopy()
+			mutate(updated)
+			Expect(ignoreStatusUpdates.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: updated})).To(Equal(expected))
+		},
+		Entry("status annotation changed", func(pr *monitoringv1.PrometheusRule) {
+			pr.Annotations[annotationStatusAbsenceRules] = "2"
+			pr.Annotations[annotationStatusError] = "boom"
+		}, false),
+		Entry("spec changed", func(pr *monitoringv1.PrometheusRule) { pr.Generation++ }, true),
+		Entry("deletion requested", func(pr *monitoringv1.PrometheusRule) { pr.DeletionTimestamp = &metav1.Time{Time: time.Unix(1, 0)} }, true),
+		Entry("label changed", func(pr *monitoringv1.PrometheusRule) { pr.Labels[labelOperatorDisable] = "true" }, true),
+		Entry("other annotation changed", func(pr *monitoringv1.PrometheusRule) { pr.Annotations["foo"] = "baz" }, true),
+	)
+})
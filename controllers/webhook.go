@@ -0,0 +1,167 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// labelOperatorPrefix is the prefix of the labels that are interpreted by the operator.
+// Their values must be booleans.
+const labelOperatorPrefix = "absent-metrics-operator/"
+
+// PrometheusRuleValidator is a validating admission webhook for PrometheusRules. It
+// parses the alert rules in the same way as the reconciler so that problems are
+// reported when a PrometheusRule is applied instead of only in the operator's logs and
+// events.
+//
+// PrometheusRules with alert expressions that can not be parsed or with invalid
+// 'absent-metrics-operator/*' labels or annotations are rejected. Selectors for which
+// no metric name can be determined only result in admission warnings.
+//
+// Policies and the mode are not taken into account since they might change
+// independently of the PrometheusRule.
+type PrometheusRuleValidator struct {
+	Log logr.Logger
+	// RuleOptions are the default options for generating absence alert rules, see
+	// PrometheusRuleReconciler.
+	RuleOptions RuleOptions
+	// WarnOnly specifies that invalid PrometheusRules are admitted and the problems are
+	// returned as admission warnings instead.
+	WarnOnly bool
+}
+
+//+kubebuilder:webhook:path=/validate-monitoring-coreos-com-v1-prometheusrule,mutating=false,failurePolicy=ignore,sideEffects=None,groups=monitoring.coreos.com,resources=prometheusrules,verbs=create;update,versions=v1,name=vprometheusrule.absent-metrics-operator.cloud.sap,admissionReviewVersions=v1
+
+// SetupWebhookWithManager registers the webhook with the manager's webhook server.
+func (v *PrometheusRuleValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&monitoringv1.PrometheusRule{}).
+		WithValidator(v).
+		Complete()
+}
+
+// ValidateCreate implements the admission.CustomValidator interface.
+func (v *PrometheusRuleValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	promRule, ok := obj.(*monitoringv1.PrometheusRule)
+	if !ok {
+		return nil, fmt.Errorf("expected a PrometheusRule but got %T", obj)
+	}
+	errs, warnings := v.validate(promRule)
+	return v.result(promRule, errs, warnings)
+}
+
+// ValidateUpdate implements the admission.CustomValidator interface.
+//
+// Only problems that were not already present before the update result in a
+// rejection. Otherwise a PrometheusRule that was created before the webhook was enabled
+// could not be updated at all, not even by the operator itself to report its status.
+func (v *PrometheusRuleValidator) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldPromRule, ok := oldObj.(*monitoringv1.PrometheusRule)
+	if !ok {
+		return nil, fmt.Errorf("expected a PrometheusRule but got %T", oldObj)
+	}
+	promRule, ok := newObj.(*monitoringv1.PrometheusRule)
+	if !ok {
+		return nil, fmt.Errorf("expected a PrometheusRule but got %T", newObj)
+	}
+	if !promRule.GetDeletionTimestamp().IsZero() {
+		// Don't get in the way of finalizers.
+		return nil, nil
+	}
+
+	errs, warnings := v.validate(promRule)
+	oldErrs, _ := v.validate(oldPromRule)
+	var newErrs field.ErrorList
+	for _, err := range errs {
+		if slices.ContainsFunc(oldErrs, func(e *field.Error) bool { return e.Error() == err.Error() }) {
+			warnings = append(warnings, err.Error())
+		} else {
+			newErrs = append(newErrs, err)
+		}
+	}
+	return v.result(promRule, newErrs, warnings)
+}
+
+// ValidateDelete implements the admission.CustomValidator interface.
+func (v *PrometheusRuleValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *PrometheusRuleValidator) result(promRule *monitoringv1.PrometheusRule, errs field.ErrorList, warnings admission.Warnings) (admission.Warnings, error) {
+	if len(errs) == 0 {
+		return warnings, nil
+	}
+	if v.WarnOnly {
+		for _, err := range errs {
+			warnings = append(warnings, err.Error())
+		}
+		return warnings, nil
+	}
+	return warnings, apierrors.NewInvalid(
+		monitoringv1.SchemeGroupVersion.WithKind(monitoringv1.PrometheusRuleKind).GroupKind(),
+		promRule.GetName(), errs)
+}
+
+// validate returns the problems that would prevent the operator from generating
+// absence alert rules for the given PrometheusRule as errors, and the problems that
+// would only result in missing absence alert rules as warnings.
+func (v *PrometheusRuleValidator) validate(promRule *monitoringv1.PrometheusRule) (field.ErrorList, admission.Warnings) {
+	var errs field.ErrorList
+	labelsPath := field.NewPath("metadata", "labels")
+	keys := make([]string, 0, len(promRule.Labels))
+	for k := range promRule.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !strings.HasPrefix(k, labelOperatorPrefix) {
+			continue
+		}
+		if _, err := strconv.ParseBool(promRule.Labels[k]); err != nil {
+			errs = append(errs, field.Invalid(labelsPath.Key(k), promRule.Labels[k], "must be 'true' or 'false'"))
+		}
+	}
+	if parseBool(promRule.Labels[labelOperatorManagedBy]) || parseBool(promRule.Labels[labelOperatorDisable]) {
+		// The operator does not parse the alert rules of AbsencePrometheusRules and of
+		// PrometheusRules for which it has been disabled.
+		return errs, nil
+	}
+
+	opts, err := v.RuleOptions.WithAnnotations(promRule.GetAnnotations())
+	if err != nil {
+		return append(errs, field.Invalid(field.NewPath("metadata", "annotations"), field.OmitValueType{}, err.Error())), nil
+	}
+	opts.PrometheusRule = promRule.ObjectMeta
+
+	var warnings admission.Warnings
+	groupsPath := field.NewPath("spec", "groups")
+	for i, g := range promRule.Spec.Groups {
+		for j, r := range g.Rules {
+			rulePath := groupsPath.Index(i).Child("rules").Index(j)
+			opts.OnUnresolvedSelector = func(alert, selector string) {
+				warnings = append(warnings, fmt.Sprintf(
+					"%s: could not determine the metric name(s) for the selector %s in alert %q, no absence alert rule will be generated for it",
+					rulePath, selector, alert))
+			}
+			if _, err := parseRule(v.Log, r, opts); err != nil {
+				errs = append(errs, field.Invalid(rulePath, r.Alert, err.Error()))
+			}
+		}
+	}
+	return errs, warnings
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var _ = Describe("PrometheusRuleValidator", func() {
+	ctx := context.Background()
+	promRule := func(l map[string]string, exprs ...string) *monitoringv1.PrometheusRule {
+		rules := make([]monitoringv1.Rule, 0, len(exprs))
+		for _, e := range exprs {
+			rules = append(rules, monitoringv1.Rule{Alert: "Foo", Expr: intstr.FromString(e)})
+		}
+		return &monitoringv1.PrometheusRule{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "resmgmt", Name: "openstack-limes-api.alerts", Labels: l},
+			Spec:       monitoringv1.PrometheusRuleSpec{Groups: []monitoringv1.RuleGroup{{Name: "foo.alerts", Rules: rules}}},
+		}
+	}
+
+	It("admits valid PrometheusRules", func() {
+		v := &PrometheusRuleValidator{}
+		warnings, err := v.ValidateCreate(ctx, promRule(map[string]string{labelOperatorDisable: "false"}, "limes_foo > 0"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(warnings).To(BeEmpty())
+	})
+
+	It("rejects invalid expressions and labels", func() {
+		v := &PrometheusRuleValidator{}
+		_, err := v.ValidateCreate(ctx, promRule(map[string]string{labelOperatorDisable: "yes"}, "limes_foo > 0", "limes_bar >"))
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring(`metadata.labels[absent-metrics-operator/disable]: Invalid value: "yes"`))
+		Expect(err.Error()).To(ContainSubstring(`spec.groups[0].rules[1]: Invalid value: "Foo": could not parse rule expression`))
+		Expect(err.Error()).ToNot(ContainSubstring("rules[0]"))
+
+		v.WarnOnly = true
+		warnings, err := v.ValidateCreate(ctx, promRule(nil, "limes_bar >"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(warnings).To(ConsistOf(ContainSubstring("could not parse rule expression")))
+	})
+
+	It("warns about selectors without a metric name", func() {
+		v := &PrometheusRuleValidator{}
+		warnings, err := v.ValidateCreate(ctx, promRule(nil, `{__name__=~"limes_.*"} > 0`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(warnings).To(ConsistOf(
+			`spec.groups[0].rules[0]: could not determine the metric name(s) for the selector {__name__=~"limes_.*"} in alert "Foo", no absence alert rule will be generated for it`,
+		))
+	})
+
+	It("only rejects updates that introduce new problems", func() {
+		v := &PrometheusRuleValidator{}
+		old := promRule(nil, "limes_bar >")
+		updated := old.DeepCopy()
+		updated.Annotations = map[string]string{annotationStatusError: "foo"}
+		warnings, err := v.ValidateUpdate(ctx, old, updated)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(warnings).To(HaveLen(1))
+
+		updated.Spec.Groups[0].Rules = append(updated.Spec.Groups[0].Rules, monitoringv1.Rule{Alert: "Bar", Expr: intstr.FromString("limes_baz >")})
+		_, err = v.ValidateUpdate(ctx, old, updated)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.groups[0].rules[1]"))
+	})
+})
@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/sapcc/absent-metrics-operator/controllers"
+)
+
+// runDiff implements the 'diff' subcommand. It reads the objects from the given files
+// or directories, or from the cluster if none are given, and writes the changes that
+// the operator would make to the AbsencePrometheusRules as unified diffs to w.
+//
+// Like diff(1), it returns the exit code 1 if there are changes and 2 on error.
+func runDiff(ctx context.Context, w io.Writer, paths []string, r *controllers.PrometheusRuleReconciler) int {
+	changed, err := writeDiff(ctx, w, paths, r)
+	switch {
+	case err != nil:
+		setupLog.Error(err, "unable to diff AbsencePrometheusRules")
+		return 2
+	case changed:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// writeDiff does the actual work of runDiff. It returns whether there are any changes.
+func writeDiff(ctx context.Context, w io.Writer, paths []string, r *controllers.PrometheusRuleReconciler) (bool, error) {
+	var reader client.Reader
+	if len(paths) == 0 {
+		c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: r.Scheme})
+		if err != nil {
+			return false, err
+		}
+		reader = c
+	} else {
+		c := fake.NewClientBuilder().WithScheme(r.Scheme).Build()
+		for _, path := range paths {
+			objs, err := readObjects(path)
+			if err != nil {
+				return false, fmt.Errorf("could not read %s: %w", path, err)
+			}
+			for _, obj := range objs {
+				obj.SetResourceVersion("")
+				if err := c.Create(ctx, obj); err != nil {
+					return false, fmt.Errorf("could not load %s: %w", path, err)
+				}
+			}
+		}
+		reader = c
+	}
+
+	diffs, err := r.Diff(ctx, reader)
+	if err != nil {
+		return false, err
+	}
+	for _, d := range diffs {
+		if _, err := io.WriteString(w, d.Diff); err != nil {
+			return false, err
+		}
+	}
+	return len(diffs) > 0, nil
+}
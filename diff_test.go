@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/sapcc/absent-metrics-operator/controllers"
+)
+
+const diffTestPrometheusRule = `apiVersion: monitoring.coreos.com/v1
+kind: PrometheusRule
+metadata:
+  name: openstack-limes-api.alerts
+  namespace: resmgmt
+  labels:
+    prometheus: openstack
+spec:
+  groups:
+    - name: foo.alerts
+      rules:
+        - alert: LimesFoo
+          expr: limes_foo > 0
+`
+
+var _ = Describe("diff subcommand", func() {
+	ctx := context.Background()
+
+	newReconciler := func() *controllers.PrometheusRuleReconciler {
+		nameGen, err := controllers.CreateAbsencePromRuleNameGenerator(controllers.DefaultAbsencePromRuleNameTemplate)
+		Expect(err).ToNot(HaveOccurred())
+		return &controllers.PrometheusRuleReconciler{
+			Scheme:             scheme,
+			Log:                zap.New(zap.UseDevMode(true)),
+			PrometheusRuleName: nameGen,
+		}
+	}
+	writeFile := func(content string) string {
+		path := filepath.Join(GinkgoT().TempDir(), "objects.yaml")
+		Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+		return path
+	}
+
+	It("exits with 0 if there are no changes", func() {
+		var buf bytes.Buffer
+		disabled := strings.Replace(diffTestPrometheusRule, "    prometheus: openstack\n",
+			"    prometheus: openstack\n    absent-metrics-operator/disable: \"true\"\n", 1)
+		Expect(runDiff(ctx, &buf, []string{writeFile(disabled)}, newReconciler())).To(Equal(0))
+		Expect(buf.String()).To(BeEmpty())
+	})
+
+	It("exits with 1 if there are changes", func() {
+		var buf bytes.Buffer
+		Expect(runDiff(ctx, &buf, []string{writeFile(diffTestPrometheusRule)}, newReconciler())).To(Equal(1))
+		Expect(buf.String()).To(HavePrefix("--- /dev/null\n+++ b/resmgmt/openstack-absent-metric-alert-rules\n"))
+	})
+
+	It("exits with 2 on error", func() {
+		var buf bytes.Buffer
+		path := filepath.Join(GinkgoT().TempDir(), "missing.yaml")
+		Expect(runDiff(ctx, &buf, []string{path}, newReconciler())).To(Equal(2))
+		Expect(buf.String()).To(BeEmpty())
+	})
+})
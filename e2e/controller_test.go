@@ -4,26 +4,34 @@
 package test
 
 import (
+	"encoding/json"
 	"io"
+	"maps"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/yaml"
 
+	absentmetricsv1alpha1 "github.com/sapcc/absent-metrics-operator/api/v1alpha1"
 	"github.com/sapcc/absent-metrics-operator/controllers"
 )
 
@@ -67,6 +75,20 @@ var _ = Describe("Controller", Ordered, func() {
 				)
 			})
 
+			It("should report the status on the PrometheusRules", func() {
+				pr := getPromRule(newObjKey(resmgmtNs, "kubernetes-keppel.alerts"))
+				expected := getFixture("resmgmt_kubernetes_absent_metric_alert_rules.yaml")
+				absenceRules := 0
+				for _, g := range expected.Spec.Groups {
+					absenceRules += len(g.Rules)
+				}
+				Expect(pr.Annotations).To(HaveKeyWithValue("status.absent-metrics-operator/absence-prometheusrule", k8sAbsencePRName))
+				Expect(pr.Annotations).To(HaveKeyWithValue("status.absent-metrics-operator/absence-rules", strconv.Itoa(absenceRules)))
+				Expect(pr.Annotations).To(HaveKeyWithValue("status.absent-metrics-operator/last-success", "1970-01-01T00:00:01Z"))
+				Expect(pr.Annotations).ToNot(HaveKey("status.absent-metrics-operator/error"))
+				Expect(pr.Finalizers).To(ContainElement("absent-metrics-operator/cleanup"))
+			})
+
 			It("should not create "+osAbsencePRName+" in "+swiftNs+" namespace", func() {
 				expectToNotFindPromRule(newObjKey(swiftNs, osAbsencePRName))
 			})
@@ -108,7 +130,7 @@ var _ = Describe("Controller", Ordered, func() {
 				Expect(k8sClient.Update(ctx, &pr)).To(Succeed())
 
 				// Generate the corresponding absence alert rules.
-				expected := checkErrAndReturnResult(controllers.ParseRuleGroups(logger, pr.Spec.Groups, pr.GetName(), keepLabel))
+				expected := checkErrAndReturnResult(controllers.ParseRuleGroups(logger, pr.Spec.Groups, pr.GetName(), controllers.RuleOptions{KeepLabel: keepLabel}))
 
 				// Get the updated AbsencePromRule from the server and check if it has the
 				// corresponding absence alert rule.
@@ -138,7 +160,7 @@ var _ = Describe("Controller", Ordered, func() {
 				Expect(k8sClient.Update(ctx, &pr)).To(Succeed())
 
 				// Generate the corresponding absence alert rules.
-				expected := checkErrAndReturnResult(controllers.ParseRuleGroups(logger, pr.Spec.Groups, pr.GetName(), keepLabel))
+				expected := checkErrAndReturnResult(controllers.ParseRuleGroups(logger, pr.Spec.Groups, pr.GetName(), controllers.RuleOptions{KeepLabel: keepLabel}))
 
 				// Get the updated AbsencePromRule from the server and check if the
 				// corresponding absence alert rule has been updated.
@@ -150,12 +172,66 @@ var _ = Describe("Controller", Ordered, func() {
 		})
 	})
 
+	Describe("Drift", func() {
+		prObjKey := newObjKey(swiftNs, osAbsencePRName)
+
+		Context("when an AbsencePromRule is changed manually", func() {
+			It("should restore "+osAbsencePRName+" in "+swiftNs+" namespace", func() {
+				absencePR := getPromRule(prObjKey)
+				expected := absencePR.Spec.Groups
+				absencePR.Spec.Groups[0].Rules[0].Expr = intstr.FromString("absent(something_else)")
+				absencePR.Labels["app.kubernetes.io/instance"] = "gitops"
+				Expect(k8sClient.Update(ctx, &absencePR)).To(Succeed())
+
+				// The operator only takes over the fields that it manages. Metadata that
+				// was added by someone else is left as is.
+				waitForControllerToProcess()
+				absencePR = getPromRule(prObjKey)
+				Expect(absencePR.Spec.Groups).To(Equal(expected))
+				Expect(absencePR.Labels).To(HaveKeyWithValue("app.kubernetes.io/instance", "gitops"))
+			})
+		})
+
+		Context("when an AbsencePromRule is deleted manually", func() {
+			It("should recreate "+osAbsencePRName+" in "+swiftNs+" namespace", func() {
+				expected := getPromRule(prObjKey).Spec.Groups
+				deletePromRule(prObjKey)
+
+				waitForControllerToProcess()
+				Expect(getPromRule(prObjKey).Spec.Groups).To(Equal(expected))
+			})
+		})
+
+		Context("when an AbsencePromRule is overridden manually", func() {
+			It("should leave "+osAbsencePRName+" in "+swiftNs+" namespace as is", func() {
+				absencePR := getPromRule(prObjKey)
+				expected := absencePR.Spec.Groups
+				absencePR.Annotations["absent-metrics-operator/manual-override"] = "true"
+				absencePR.Spec.Groups[0].Rules[0].Expr = intstr.FromString("absent(something_else)")
+				Expect(k8sClient.Update(ctx, &absencePR)).To(Succeed())
+
+				waitForControllerToProcess()
+				absencePR = getPromRule(prObjKey)
+				Expect(absencePR.Spec.Groups[0].Rules[0].Expr).To(Equal(intstr.FromString("absent(something_else)")))
+
+				// The AbsencePromRule is restored once the annotation is removed.
+				delete(absencePR.Annotations, "absent-metrics-operator/manual-override")
+				Expect(k8sClient.Update(ctx, &absencePR)).To(Succeed())
+
+				waitForControllerToProcess()
+				Expect(getPromRule(prObjKey).Spec.Groups).To(Equal(expected))
+			})
+		})
+	})
+
 	Describe("Cleanup", func() {
 		Context("when a PrometheusRule is deleted", func() {
 			It("should delete "+k8sAbsencePRName+" in "+resmgmtNs+" namespace", func() {
 				deletePromRule(newObjKey(resmgmtNs, "kubernetes-keppel.alerts"))
 				waitForControllerToProcess()
 				expectToNotFindPromRule(newObjKey(resmgmtNs, k8sAbsencePRName))
+				// The finalizer is removed after the cleanup.
+				expectToNotFindPromRule(newObjKey(resmgmtNs, "kubernetes-keppel.alerts"))
 			})
 
 			It("should delete orphaned absence alert rules from "+osAbsencePRName+" in "+resmgmtNs+" namespace", func() {
@@ -231,7 +307,7 @@ var _ = Describe("Controller", Ordered, func() {
 				Expect(k8sClient.Update(ctx, &pr)).To(Succeed())
 
 				// Generate the corresponding absence alert rules.
-				expected := checkErrAndReturnResult(controllers.ParseRuleGroups(logger, pr.Spec.Groups, pr.GetName(), keepLabel))
+				expected := checkErrAndReturnResult(controllers.ParseRuleGroups(logger, pr.Spec.Groups, pr.GetName(), controllers.RuleOptions{KeepLabel: keepLabel}))
 
 				// Check that the corresponding absence alert rule was removed.
 				waitForControllerToProcess()
@@ -240,6 +316,30 @@ var _ = Describe("Controller", Ordered, func() {
 			})
 		})
 
+		Context("with an AbsenceRulePolicy", func() {
+			It("should delete and then recreate "+osAbsencePRName+" in "+swiftNs+" namespace", func() {
+				// Disable the operator for all PromRules in the namespace using a policy.
+				// This should result in the deletion of the corresponding AbsencePromRule.
+				expected := getPromRule(prObjKey)
+				disabled := true
+				policy := absentmetricsv1alpha1.AbsenceRulePolicy{
+					ObjectMeta: metav1.ObjectMeta{Namespace: swiftNs, Name: "disable-all"},
+					Spec:       absentmetricsv1alpha1.AbsenceRulePolicySpec{Disabled: &disabled},
+				}
+				Expect(k8sClient.Create(ctx, &policy)).To(Succeed())
+
+				waitForControllerToProcess()
+				expectToNotFindPromRule(prObjKey)
+
+				// Deleting the policy should result in the AbsencePromRule being
+				// generated again.
+				Expect(k8sClient.Delete(ctx, &policy)).To(Succeed())
+
+				waitForControllerToProcess()
+				Expect(getPromRule(prObjKey).Spec).To(Equal(expected.Spec))
+			})
+		})
+
 		Context("for an entire PrometheusRule", func() {
 			It("should delete "+osAbsencePRName+" in "+swiftNs+" namespace", func() {
 				// Add the 'absent-metrics-operator/disable' label to the PromRule. This
@@ -261,8 +361,35 @@ var _ = Describe("Controller", Ordered, func() {
 			var requestBody io.Reader
 			request := httptest.NewRequest(method, path, requestBody)
 
+			// The operations on AbsencePrometheusRules and the number of orphaned rule
+			// groups depend on the timing of the reconciliations, therefore they are not
+			// compared with the fixture.
+			nondeterministic := []string{
+				"absent_metrics_operator_absence_prometheusrule_operations_total",
+				"absent_metrics_operator_absence_prometheusrule_operation_duration_seconds",
+				"absent_metrics_operator_orphaned_rule_groups_cleaned_up_total",
+			}
+			// The gauges for the number of absence alert rules and skipped metrics are not
+			// in the fixture since they must not have any series left at this point: all
+			// AbsencePrometheusRules have been deleted and the only remaining
+			// PrometheusRule (resmgmt/openstack-limes-api.alerts) no longer has any alert
+			// rules. This is checked explicitly for a more helpful failure message.
+			for _, mf := range checkErrAndReturnResult(reg.Gather()) {
+				Expect(mf.GetName()).ToNot(BeElementOf(
+					"absent_metrics_operator_absence_rules",
+					"absent_metrics_operator_skipped_metrics",
+				), "gauge has orphaned series: %v", mf.GetMetric())
+			}
+
+			gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+				mfs, err := reg.Gather()
+				return slices.DeleteFunc(mfs, func(mf *dto.MetricFamily) bool {
+					return slices.Contains(nondeterministic, mf.GetName())
+				}), err
+			})
+
 			recorder := httptest.NewRecorder()
-			handler := promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+			handler := promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
 			handler.ServeHTTP(recorder, request)
 			response := recorder.Result()
 			Expect(response.StatusCode).To(Equal(http.StatusOK))
@@ -295,8 +422,22 @@ func checkErrAndReturnResult[T any](result T, err error) T {
 func expectPromRulesToMatch(expected, actual monitoringv1.PrometheusRule) {
 	GinkgoHelper()
 	Expect(actual.Labels).To(Equal(expected.Labels))
-	Expect(actual.Annotations).To(Equal(expected.Annotations))
 	Expect(actual.Spec).To(Equal(expected.Spec))
+
+	// The sources of the rule groups contain the UIDs of the PrometheusRules, which are
+	// different for each test run, therefore we only check their names.
+	annotations := maps.Clone(actual.Annotations)
+	var sources map[string]struct {
+		Name string `json:"name"`
+	}
+	Expect(json.Unmarshal([]byte(annotations["absent-metrics-operator/rule-group-sources"]), &sources)).To(Succeed())
+	delete(annotations, "absent-metrics-operator/rule-group-sources")
+	Expect(annotations).To(Equal(expected.Annotations))
+	Expect(sources).To(HaveLen(len(expected.Spec.Groups)))
+	for _, g := range expected.Spec.Groups {
+		promRuleName, _, _ := strings.Cut(g.Name, "/")
+		Expect(sources).To(HaveKeyWithValue(g.Name, HaveField("Name", promRuleName)))
+	}
 }
 
 // Wait for controller to resync and complete its processing.
@@ -16,17 +16,22 @@ import (
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/sync/errgroup"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/yaml"
 
+	absentmetricsv1alpha1 "github.com/sapcc/absent-metrics-operator/api/v1alpha1"
 	"github.com/sapcc/absent-metrics-operator/controllers"
 	//+kubebuilder:scaffold:imports
 )
@@ -37,6 +42,7 @@ import (
 var (
 	logger logr.Logger
 
+	cfg       *rest.Config
 	k8sClient client.Client
 	testEnv   *envtest.Environment
 	reg       *prometheus.Registry
@@ -65,18 +71,27 @@ var _ = BeforeSuite(func() {
 
 	By("bootstrapping test environment")
 	testEnv = &envtest.Environment{
-		CRDDirectoryPaths:     []string{"crd"},
+		CRDDirectoryPaths:     []string{"crd", filepath.Join("..", "crd")},
 		ErrorIfCRDPathMissing: true,
+		WebhookInstallOptions: envtest.WebhookInstallOptions{
+			ValidatingWebhooks: []*admissionregistrationv1.ValidatingWebhookConfiguration{validatingWebhookConfiguration()},
+		},
 	}
-	cfg := checkErrAndReturnResult(testEnv.Start())
+	cfg = checkErrAndReturnResult(testEnv.Start())
 
 	Expect(monitoringv1.AddToScheme(scheme.Scheme)).To(Succeed())
+	Expect(absentmetricsv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
 
 	mgr := checkErrAndReturnResult(ctrl.NewManager(cfg, ctrl.Options{
 		Scheme: scheme.Scheme,
 		Metrics: metricsserver.Options{
 			BindAddress: "0",
 		},
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Host:    testEnv.WebhookInstallOptions.LocalServingHost,
+			Port:    testEnv.WebhookInstallOptions.LocalServingPort,
+			CertDir: testEnv.WebhookInstallOptions.LocalServingCertDir,
+		}),
 	}))
 
 	reg = controllers.RegisterMetrics()
@@ -85,9 +100,16 @@ var _ = BeforeSuite(func() {
 		Client:             mgr.GetClient(),
 		Scheme:             mgr.GetScheme(),
 		Log:                ctrl.Log.WithName("controller").WithName("prometheusrule"),
-		KeepLabel:          keepLabel,
+		Recorder:           mgr.GetEventRecorderFor("absent-metrics-operator"),
+		RuleOptions:        controllers.RuleOptions{KeepLabel: keepLabel},
 		PrometheusRuleName: checkErrAndReturnResult(controllers.CreateAbsencePromRuleNameGenerator(controllers.DefaultAbsencePromRuleNameTemplate)),
+		EnablePolicies:     true,
+		UseFinalizer:       true,
 	}).SetupWithManager(mgr)).To(Succeed())
+	Expect((&controllers.PrometheusRuleValidator{
+		Log:         ctrl.Log.WithName("webhook").WithName("prometheusrule"),
+		RuleOptions: controllers.RuleOptions{KeepLabel: keepLabel},
+	}).SetupWebhookWithManager(mgr)).To(Succeed())
 
 	//+kubebuilder:scaffold:scheme
 
@@ -102,6 +124,9 @@ var _ = BeforeSuite(func() {
 	wg.Go(func() error {
 		return mgr.Start(ctx)
 	})
+	// The webhook must be available before any PrometheusRule is created since the
+	// failure policy is 'Fail'.
+	Eventually(func() error { return mgr.GetWebhookServer().StartedChecker()(nil) }).Should(Succeed())
 
 	By("adding mock PrometheusRule resources")
 	Expect(addMockPrometheusRules(ctx)).To(Succeed())
@@ -122,6 +147,35 @@ var _ = AfterSuite(func() {
 ///////////////////////////////////////////////////////////////////////////////
 // Helper functions
 
+// validatingWebhookConfiguration returns the configuration for the
+// PrometheusRuleValidator. The service is replaced with the local webhook server by
+// envtest.
+func validatingWebhookConfiguration() *admissionregistrationv1.ValidatingWebhookConfiguration {
+	path := "/validate-monitoring-coreos-com-v1-prometheusrule"
+	failurePolicy := admissionregistrationv1.Fail
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	return &admissionregistrationv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "absent-metrics-operator"},
+		Webhooks: []admissionregistrationv1.ValidatingWebhook{{
+			Name: "vprometheusrule.absent-metrics-operator.cloud.sap",
+			ClientConfig: admissionregistrationv1.WebhookClientConfig{
+				Service: &admissionregistrationv1.ServiceReference{Namespace: "system", Name: "webhook-service", Path: &path},
+			},
+			Rules: []admissionregistrationv1.RuleWithOperations{{
+				Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update},
+				Rule: admissionregistrationv1.Rule{
+					APIGroups:   []string{monitoringv1.SchemeGroupVersion.Group},
+					APIVersions: []string{monitoringv1.SchemeGroupVersion.Version},
+					Resources:   []string{monitoringv1.PrometheusRuleName},
+				},
+			}},
+			FailurePolicy:           &failurePolicy,
+			SideEffects:             &sideEffects,
+			AdmissionReviewVersions: []string{"v1"},
+		}},
+	}
+}
+
 func addMockPrometheusRules(ctx context.Context) error {
 	mockDir := filepath.Join("fixtures", "start-data")
 	mockFiles, err := os.ReadDir(mockDir)
@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package test
+
+import (
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Webhook", func() {
+	// The PrometheusRules are only created with dry run so that they are not reconciled
+	// and do not interfere with the other tests.
+	newPromRule := func(l map[string]string, exprs ...string) *monitoringv1.PrometheusRule {
+		rules := make([]monitoringv1.Rule, 0, len(exprs))
+		for _, e := range exprs {
+			rule := createMockRule("webhook_foo")
+			rule.Expr = intstr.FromString(e)
+			rules = append(rules, rule)
+		}
+		return &monitoringv1.PrometheusRule{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "resmgmt", Name: "webhook.alerts", Labels: l},
+			Spec:       monitoringv1.PrometheusRuleSpec{Groups: []monitoringv1.RuleGroup{{Name: "webhook.alerts", Rules: rules}}},
+		}
+	}
+
+	It("should admit a valid PrometheusRule", func() {
+		Expect(k8sClient.Create(ctx, newPromRule(nil, "webhook_foo > 0"), client.DryRunAll)).To(Succeed())
+	})
+
+	It("should reject an alert expression that can not be parsed", func() {
+		err := k8sClient.Create(ctx, newPromRule(nil, "webhook_foo > 0", "webhook_foo >"), client.DryRunAll)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("spec.groups[0].rules[1]"))
+		Expect(err.Error()).To(ContainSubstring("could not parse rule expression"))
+	})
+
+	It("should reject an operator label that is not a boolean", func() {
+		err := k8sClient.Create(ctx, newPromRule(map[string]string{"absent-metrics-operator/disable": "yes"}, "webhook_foo > 0"), client.DryRunAll)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("metadata.labels[absent-metrics-operator/disable]"))
+	})
+
+	It("should warn about a selector without a metric name", func() {
+		warnings := &warningRecorder{}
+		c := rest.CopyConfig(cfg)
+		c.WarningHandler = warnings
+		warningClient, err := client.New(c, client.Options{Scheme: scheme.Scheme})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(warningClient.Create(ctx, newPromRule(nil, `{__name__=~"webhook_.*"} > 0`), client.DryRunAll)).To(Succeed())
+		Expect(warnings.get()).To(ConsistOf(ContainSubstring(`could not determine the metric name(s) for the selector {__name__=~"webhook_.*"}`)))
+	})
+})
+
+// warningRecorder is a rest.WarningHandler that records the warnings returned by the
+// API server.
+type warningRecorder struct {
+	mu       sync.Mutex
+	warnings []string
+}
+
+// HandleWarningHeader implements the rest.WarningHandler interface.
+func (w *warningRecorder) HandleWarningHeader(_ int, _, text string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.warnings = append(w.warnings, text)
+}
+
+func (w *warningRecorder) get() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.warnings
+}
@@ -0,0 +1,204 @@
+// SPDX-FileCopyrightText: 2025 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/sapcc/absent-metrics-operator/controllers"
+)
+
+// runGenerate implements the 'generate' subcommand. It reads PrometheusRule manifests
+// from the given files, or from stdin if no files (or '-') are given, and writes the
+// corresponding AbsencePrometheusRules as YAML to w.
+func runGenerate(
+	w io.Writer,
+	paths []string,
+	nameGen *controllers.AbsencePromRuleNameGenerator,
+	opts controllers.RuleOptions,
+	aggregateSourceAlerts bool,
+) error {
+
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+	var promRules []monitoringv1.PrometheusRule
+	for _, path := range paths {
+		prs, err := readPrometheusRules(path)
+		if err != nil {
+			return fmt.Errorf("could not read %s: %w", path, err)
+		}
+		promRules = append(promRules, prs...)
+	}
+
+	absencePromRules, err := controllers.GenerateAbsencePrometheusRules(
+		ctrl.Log.WithName("generate"), promRules, nameGen, opts, aggregateSourceAlerts)
+	if err != nil {
+		return err
+	}
+	for i, aPR := range absencePromRules {
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&aPR)
+		if err != nil {
+			return err
+		}
+		unstructured.RemoveNestedField(obj, "metadata", "creationTimestamp")
+		buf, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readPrometheusRules reads all PrometheusRules from the given file, see readObjects().
+func readPrometheusRules(path string) ([]monitoringv1.PrometheusRule, error) {
+	objs, err := readObjects(path)
+	if err != nil {
+		return nil, err
+	}
+	var result []monitoringv1.PrometheusRule
+	for _, obj := range objs {
+		if pr, ok := obj.(*monitoringv1.PrometheusRule); ok {
+			result = append(result, *pr)
+		}
+	}
+	return result, nil
+}
+
+// readObjects reads all objects from a file that contains one or more YAML or JSON
+// documents, or from all such files in a directory and its subdirectories. Lists, e.g.
+// the output of 'kubectl get -o yaml', are flattened. Documents that are not Kubernetes
+// objects or whose kind is not known to the operator are ignored.
+func readObjects(path string) ([]client.Object, error) {
+	if path == "-" {
+		return decodeObjects(os.Stdin)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return readObjectsFromFile(path)
+	}
+
+	var result []client.Object
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		switch filepath.Ext(p) {
+		case ".yaml", ".yml", ".json":
+			objs, err := readObjectsFromFile(p)
+			if err != nil {
+				return fmt.Errorf("could not read %s: %w", p, err)
+			}
+			result = append(result, objs...)
+		}
+		return nil
+	})
+	return result, err
+}
+
+func readObjectsFromFile(path string) ([]client.Object, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return decodeObjects(f)
+}
+
+func decodeObjects(r io.Reader) ([]client.Object, error) {
+	var result []client.Object
+	dec := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) == 0 || string(raw) == "null" {
+			// Empty document.
+			continue
+		}
+		objs, err := decodeObject(raw, nil)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, objs...)
+	}
+}
+
+// decodeObject decodes a single object or the items of a list. The defaultGVK is used
+// for list items that do not specify their kind.
+func decodeObject(raw []byte, defaultGVK *schema.GroupVersionKind) ([]client.Object, error) {
+	var tm metav1.TypeMeta
+	if err := json.Unmarshal(raw, &tm); err != nil {
+		return nil, err
+	}
+	if kind, ok := strings.CutSuffix(tm.Kind, "List"); ok {
+		var list struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, err
+		}
+		var itemGVK *schema.GroupVersionKind
+		if kind != "" {
+			gvk := tm.GroupVersionKind().GroupVersion().WithKind(kind)
+			itemGVK = &gvk
+		}
+		var result []client.Object
+		for _, item := range list.Items {
+			objs, err := decodeObject(item, itemGVK)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, objs...)
+		}
+		return result, nil
+	}
+
+	obj, _, err := serializer.NewCodecFactory(scheme).UniversalDeserializer().Decode(raw, defaultGVK, nil)
+	if runtime.IsNotRegisteredError(err) || runtime.IsMissingKind(err) || runtime.IsMissingVersion(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cObj, ok := obj.(client.Object)
+	if !ok {
+		return nil, nil
+	}
+	return []client.Object{cObj}, nil
+}
@@ -4,10 +4,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"strings"
+	"sync/atomic"
 
 	_ "go.uber.org/automaxprocs"
 
@@ -17,14 +20,23 @@ import (
 
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	"github.com/sapcc/go-api-declarations/bininfo"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
+	absentmetricsv1alpha1 "github.com/sapcc/absent-metrics-operator/api/v1alpha1"
 	"github.com/sapcc/absent-metrics-operator/controllers"
 	//+kubebuilder:scaffold:imports
 )
@@ -37,18 +49,50 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(monitoringv1.AddToScheme(scheme))
+	utilruntime.Must(absentmetricsv1alpha1.AddToScheme(scheme))
 
 	//+kubebuilder:scaffold:scheme
 }
 
 func main() {
+	// The 'generate' and 'diff' subcommands take the same flags as the operator, e.g.
+	// 'absent-metrics-operator generate -keep-labels=service rules.yaml'.
+	args := os.Args[1:]
+	var subcommand string
+	if len(args) > 0 && (args[0] == "generate" || args[0] == "diff") {
+		subcommand = args[0]
+		args = args[1:]
+	}
+
 	var (
 		debug                bool
 		metricsAddr          string
 		probeAddr            string
 		enableLeaderElection bool
 		keepLabel            labelsMap
+		keepLabelMatchers    bool
 		prometheusRuleName   string
+		skipMetrics          stringList
+		onlyMetrics          stringList
+		metricFilterCM       string
+		absenceModeStr       string
+		absenceRangeStr      string
+		absenceForStr        string
+		absenceForPolicyStr  string
+		absenceRuleTmplPath  string
+		severityMapStr       string
+		aggregateSrcAlerts   bool
+		enablePolicies       bool
+		useFinalizer         bool
+		removeFinalizers     bool
+		namespaces           stringList
+		namespaceSelector    string
+		promRuleSelector     string
+		modeStr              string
+		dryRun               bool
+		dryRunCM             string
+		enableWebhook        bool
+		webhookWarnOnly      bool
 	)
 	bininfo.HandleVersionArgument()
 
@@ -63,9 +107,70 @@ func main() {
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.Var(&keepLabel, "keep-labels", "A comma-separated list of labels to retain from the original alert rule. "+
 		fmt.Sprintf("(default '%s,%s,%s')", controllers.LabelSupportGroup, controllers.LabelTier, controllers.LabelService))
+	flag.BoolVar(&keepLabelMatchers, "keep-label-matchers", false,
+		"Retain equality label matchers from the original alert rule expression in the absence alert rule expression. "+
+			"Can be overridden per PrometheusRule with the 'absent-metrics-operator/keep-label-matchers' annotation.")
+	flag.Var(&skipMetrics, "skip-metrics", "A comma-separated list of metric name patterns (globs or regexes enclosed in slashes) "+
+		"for which no absence alert rules are generated.")
+	flag.Var(&onlyMetrics, "only-metrics", "A comma-separated list of metric name patterns (globs or regexes enclosed in slashes). "+
+		"If provided, absence alert rules are only generated for metrics that match any of these patterns.")
+	flag.StringVar(&metricFilterCM, "metric-filter-configmap", "",
+		"The ConfigMap (in the format 'namespace/name') that holds additional metric name patterns in the "+
+			fmt.Sprintf("'%s' and '%s' keys. Changes to it are applied without a restart.", controllers.MetricNameFilterSkipKey, controllers.MetricNameFilterOnlyKey))
+	flag.StringVar(&absenceModeStr, "absence-mode", string(controllers.DefaultAbsenceMode),
+		fmt.Sprintf("The function used in absence alert rule expressions: '%s' or '%s'. ", controllers.AbsenceModeAbsent, controllers.AbsenceModeOverTime)+
+			"Can be overridden with the 'absent-metrics-operator/absence-mode' annotation.")
+	flag.StringVar(&absenceRangeStr, "absence-range", string(controllers.DefaultAbsenceRange),
+		"The range used with the 'over_time' absence mode. Can be overridden with the 'absent-metrics-operator/absence-range' annotation.")
+	flag.StringVar(&absenceForStr, "absence-for", string(controllers.DefaultAbsenceFor),
+		"The 'for' duration of absence alert rules. Can be overridden with the 'absent-metrics-operator/absence-for' annotation.")
+	flag.StringVar(&absenceForPolicyStr, "absence-for-policy", string(controllers.AbsenceForPolicyFixed),
+		"How the 'for' duration of absence alert rules is derived from the original alert rule: "+
+			"'fixed' (always use --absence-for), 'max' (the original duration with --absence-for as the lower bound), "+
+			"or 'multiply:<factor>' (the original duration multiplied by the factor). "+
+			"Can be overridden with the 'absent-metrics-operator/absence-for-policy' annotation.")
+	flag.StringVar(&absenceRuleTmplPath, "absence-rule-template", "",
+		"Path to a file with a Go template that renders the expression, 'for' duration, labels, and annotations of absence alert rules. "+
+			"The built-in default template is used if empty.")
+	flag.BoolVar(&aggregateSrcAlerts, "aggregate-source-alerts", false,
+		"List the alert rules from all PrometheusRules whose absence alert rules end up in the same AbsencePrometheusRule "+
+			"in the 'all_source_alerts' annotation of absence alert rules.")
+	flag.StringVar(&severityMapStr, "severity-map", "",
+		"A comma-separated list of 'source=target' pairs that maps the severity of the original alert rule to the severity of the absence alert rule, "+
+			"e.g. 'critical=warning,warning=info'. The order specifies the priority if multiple alert rules use the same metric. "+
+			fmt.Sprintf("Unmapped severities result in '%s'.", controllers.DefaultAbsenceSeverity))
+	flag.BoolVar(&enablePolicies, "enable-policies", false,
+		"Take AbsenceRulePolicy and ClusterAbsenceRulePolicy resources into account. Their CRDs must be installed.")
+	flag.BoolVar(&useFinalizer, "finalizer", false,
+		"Add a finalizer to PrometheusRules so that their absence alert rules are removed before they are deleted. "+
+			"If false, the finalizer is removed from PrometheusRules that still have it.")
+	flag.BoolVar(&removeFinalizers, "remove-finalizers", false,
+		"Remove the finalizer from all PrometheusRules and exit. Use this before uninstalling the operator if it was run with '-finalizer'.")
+	flag.Var(&namespaces, "namespaces", "A comma-separated list of namespaces to watch. All namespaces are watched if empty.")
+	flag.StringVar(&namespaceSelector, "namespace-selector", "",
+		"A label selector (e.g. 'team=foo,env!=qa') for the namespaces whose PrometheusRules are processed. "+
+			"Only the objects in matching namespaces are cached. The operator exits so that it is restarted with an updated cache when a namespace starts or stops matching. "+
+			"Absence alert rules of PrometheusRules in namespaces that no longer match are cleaned up.")
+	flag.StringVar(&promRuleSelector, "prometheusrule-selector", "",
+		"A label selector for the PrometheusRules that are processed. Only matching PrometheusRules are cached. "+
+			"The labels that the selector requires are copied to AbsencePrometheusRules so that they are cached as well.")
+	flag.StringVar(&modeStr, "mode", string(controllers.ModeOptOut),
+		fmt.Sprintf("Whether absence alert rules are generated for PrometheusRules by default: '%s' or '%s'. ", controllers.ModeOptOut, controllers.ModeOptIn)+
+			"In opt-in mode, only PrometheusRules that have the 'absent-metrics-operator/enable' label (or whose namespace has it) are processed.")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"Do not create, patch, or delete AbsencePrometheusRules and do not update PrometheusRules. The operations are only logged and counted in the metrics. "+
+			"A different leader election ID is used so that the operator can run alongside a deployment that is not in dry-run mode.")
+	flag.StringVar(&dryRunCM, "dry-run-configmap", "",
+		"The ConfigMap (in the format 'namespace/name') in which the operations that were skipped in dry-run mode are recorded. It is created if it does not exist.")
+	flag.BoolVar(&enableWebhook, "enable-webhook", false,
+		"Serve a validating admission webhook for PrometheusRules that rejects alert expressions that can not be parsed and invalid 'absent-metrics-operator/*' labels or annotations. "+
+			"The serving certificate is read from tls.crt and tls.key in /tmp/k8s-webhook-server/serving-certs and the webhook is served on port 9443.")
+	flag.BoolVar(&webhookWarnOnly, "webhook-warn-only", false,
+		"Admit invalid PrometheusRules and only return admission warnings in the validating admission webhook.")
 	opts := zap.Options{}
 	opts.BindFlags(flag.CommandLine)
-	flag.Parse()
+	// The error can be ignored since the flag set exits on error.
+	_ = flag.CommandLine.Parse(args)
 
 	// Enable debug mode if `-debug` flag is provided.
 	if debug {
@@ -82,20 +187,222 @@ func main() {
 		}
 	}
 
+	if removeFinalizers {
+		c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+		if err != nil {
+			setupLog.Error(err, "unable to create client")
+			os.Exit(1)
+		}
+		n, err := controllers.RemoveFinalizers(ctrl.SetupSignalHandler(), c)
+		if err != nil {
+			setupLog.Error(err, "unable to remove finalizers", "removed", n)
+			os.Exit(1)
+		}
+		setupLog.Info("removed finalizers", "count", n)
+		return
+	}
+
 	prometheusRuleNameGen, err := controllers.CreateAbsencePromRuleNameGenerator(prometheusRuleName)
 	if err != nil {
 		setupLog.Error(err, "unable to parse PrometheusRule name template", "prom-rule-name", prometheusRuleName)
 		os.Exit(1)
 	}
 
+	mode, err := controllers.ParseMode(modeStr)
+	if err != nil {
+		setupLog.Error(err, "invalid value for mode flag")
+		os.Exit(1)
+	}
+	absenceMode, err := controllers.ParseAbsenceMode(absenceModeStr)
+	if err != nil {
+		setupLog.Error(err, "invalid value for absence-mode flag")
+		os.Exit(1)
+	}
+	absenceRange, err := controllers.ParseDuration(absenceRangeStr)
+	if err != nil {
+		setupLog.Error(err, "invalid value for absence-range flag")
+		os.Exit(1)
+	}
+	absenceFor, err := controllers.ParseDuration(absenceForStr)
+	if err != nil {
+		setupLog.Error(err, "invalid value for absence-for flag")
+		os.Exit(1)
+	}
+	absenceForPolicy, err := controllers.ParseAbsenceForPolicy(absenceForPolicyStr)
+	if err != nil {
+		setupLog.Error(err, "invalid value for absence-for-policy flag")
+		os.Exit(1)
+	}
+
+	severityMap, err := controllers.ParseSeverityMap(severityMapStr)
+	if err != nil {
+		setupLog.Error(err, "invalid value for severity-map flag")
+		os.Exit(1)
+	}
+
+	var absenceRuleTmpl *controllers.AbsenceRuleTemplate
+	if absenceRuleTmplPath != "" {
+		buf, err := os.ReadFile(absenceRuleTmplPath)
+		if err != nil {
+			setupLog.Error(err, "unable to read absence alert rule template", "absence-rule-template", absenceRuleTmplPath)
+			os.Exit(1)
+		}
+		absenceRuleTmpl, err = controllers.ParseAbsenceRuleTemplate(string(buf))
+		if err != nil {
+			setupLog.Error(err, "unable to parse absence alert rule template", "absence-rule-template", absenceRuleTmplPath)
+			os.Exit(1)
+		}
+	}
+
+	metricNameFilter, err := controllers.NewMetricNameFilter(skipMetrics, onlyMetrics)
+	if err != nil {
+		setupLog.Error(err, "unable to parse metric name filter")
+		os.Exit(1)
+	}
+	ruleOptions := controllers.RuleOptions{
+		KeepLabel:         controllers.KeepLabel(keepLabel),
+		KeepLabelMatchers: keepLabelMatchers,
+		MetricNameFilter:  metricNameFilter,
+		AbsenceMode:       absenceMode,
+		AbsenceRange:      absenceRange,
+		AbsenceFor:        absenceFor,
+		AbsenceForPolicy:  absenceForPolicy,
+		SeverityMap:       severityMap,
+		Template:          absenceRuleTmpl,
+	}
+
+	if subcommand == "generate" {
+		err := runGenerate(os.Stdout, flag.Args(), prometheusRuleNameGen, ruleOptions, aggregateSrcAlerts)
+		if err != nil {
+			setupLog.Error(err, "unable to generate AbsencePrometheusRules")
+			os.Exit(1)
+		}
+		return
+	}
+
+	var scope controllers.Scope
+	cacheOpts := cache.Options{ByObject: make(map[client.Object]cache.ByObject)}
+	if len(namespaces) > 0 {
+		scope.Namespaces = namespaces
+		cacheOpts.DefaultNamespaces = make(map[string]cache.Config, len(namespaces))
+		for _, ns := range namespaces {
+			cacheOpts.DefaultNamespaces[ns] = cache.Config{}
+		}
+	}
+	if namespaceSelector != "" {
+		scope.NamespaceSelector, err = labels.Parse(namespaceSelector)
+		if err != nil {
+			setupLog.Error(err, "invalid value for namespace-selector flag")
+			os.Exit(1)
+		}
+	}
+	if promRuleSelector != "" {
+		scope.PrometheusRuleSelector, err = labels.Parse(promRuleSelector)
+		if err != nil {
+			setupLog.Error(err, "invalid value for prometheusrule-selector flag")
+			os.Exit(1)
+		}
+		// Only cache the PrometheusRules that we are interested in.
+		cacheOpts.ByObject[&monitoringv1.PrometheusRule{}] = cache.ByObject{Label: scope.PrometheusRuleSelector}
+	}
+
+	var metricFilterCMKey types.NamespacedName
+	if metricFilterCM != "" {
+		metricFilterCMKey, err = parseObjectKey(metricFilterCM)
+		if err != nil {
+			setupLog.Error(err, "invalid value for metric-filter-configmap flag", "metric-filter-configmap", metricFilterCM)
+			os.Exit(1)
+		}
+		// Only cache the ConfigMap that we are interested in.
+		cacheOpts.ByObject[&corev1.ConfigMap{}] = cache.ByObject{
+			Namespaces: map[string]cache.Config{metricFilterCMKey.Namespace: {}},
+			Field:      fields.OneTermEqualSelector("metadata.name", metricFilterCMKey.Name),
+		}
+	}
+
+	var dryRunCMKey types.NamespacedName
+	if dryRunCM != "" {
+		if !dryRun {
+			setupLog.Error(errors.New("requires the dry-run flag"), "invalid value for dry-run-configmap flag")
+			os.Exit(1)
+		}
+		dryRunCMKey, err = parseObjectKey(dryRunCM)
+		if err != nil {
+			setupLog.Error(err, "invalid value for dry-run-configmap flag", "dry-run-configmap", dryRunCM)
+			os.Exit(1)
+		}
+	}
+
+	reconciler := &controllers.PrometheusRuleReconciler{
+		Scheme:             scheme,
+		Log:                ctrl.Log.WithName("controller").WithName("prometheusrule"),
+		PrometheusRuleName: prometheusRuleNameGen,
+		RuleOptions:        ruleOptions,
+
+		MetricNameFilterConfigMap: metricFilterCMKey,
+		AggregateSourceAlerts:     aggregateSrcAlerts,
+		EnablePolicies:            enablePolicies,
+		UseFinalizer:              useFinalizer,
+		Scope:                     scope,
+		Mode:                      mode,
+		DryRun:                    dryRun,
+		DryRunConfigMap:           dryRunCMKey,
+	}
+
+	if subcommand == "diff" {
+		os.Exit(runDiff(ctrl.SetupSignalHandler(), os.Stdout, flag.Args(), reconciler))
+	}
+
+	ctx, cancel := context.WithCancel(ctrl.SetupSignalHandler())
+	var restart atomic.Bool
+	if scope.NamespaceSelector != nil {
+		// Only cache the objects in the namespaces that match the selector. The cache can
+		// not be updated later on, so the operator is restarted when this changes.
+		c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+		if err != nil {
+			setupLog.Error(err, "unable to create client")
+			os.Exit(1)
+		}
+		scope.SelectedNamespaces, err = scope.SelectNamespaces(ctx, c)
+		if err != nil {
+			setupLog.Error(err, "unable to list namespaces that match the namespace-selector flag")
+			os.Exit(1)
+		}
+		setupLog.Info("selected namespaces", "namespaces", scope.SelectedNamespaces)
+		if len(scope.SelectedNamespaces) > 0 {
+			cacheOpts.DefaultNamespaces = make(map[string]cache.Config, len(scope.SelectedNamespaces))
+			for _, ns := range scope.SelectedNamespaces {
+				cacheOpts.DefaultNamespaces[ns] = cache.Config{}
+			}
+		} else {
+			// The cache would hold all namespaces without DefaultNamespaces, therefore use a
+			// label selector that does not match anything instead.
+			cacheOpts.ByObject[&monitoringv1.PrometheusRule{}] = cache.ByObject{Label: matchNothing()}
+			if enablePolicies {
+				cacheOpts.ByObject[&absentmetricsv1alpha1.AbsenceRulePolicy{}] = cache.ByObject{Label: matchNothing()}
+			}
+		}
+		reconciler.Scope = scope
+		reconciler.NamespaceSelectionChanged = func() {
+			restart.Store(true)
+			cancel()
+		}
+	}
+
+	leaderElectionID := "absent-metrics-operator.cloud.sap"
+	if dryRun {
+		// Don't compete with a deployment that is not in dry-run mode.
+		leaderElectionID = "absent-metrics-operator-dry-run.cloud.sap"
+	}
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
+		Cache:  cacheOpts,
 		Metrics: metricsserver.Options{
 			BindAddress: metricsAddr,
 		},
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "absent-metrics-operator.cloud.sap",
+		LeaderElectionID:       leaderElectionID,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
@@ -104,16 +411,39 @@ func main() {
 
 	controllers.RegisterMetrics()
 
-	if err = (&controllers.PrometheusRuleReconciler{
-		Client:             mgr.GetClient(),
-		Scheme:             mgr.GetScheme(),
-		Log:                ctrl.Log.WithName("controller").WithName("prometheusrule"),
-		KeepLabel:          controllers.KeepLabel(keepLabel),
-		PrometheusRuleName: prometheusRuleNameGen,
-	}).SetupWithManager(mgr); err != nil {
+	reconciler.Client = mgr.GetClient()
+	reconciler.Recorder = mgr.GetEventRecorderFor("absent-metrics-operator")
+	reconciler.APIReader = mgr.GetAPIReader()
+	if err = reconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PrometheusRule")
 		os.Exit(1)
 	}
+	if enableWebhook {
+		validator := &controllers.PrometheusRuleValidator{
+			Log:         ctrl.Log.WithName("webhook").WithName("prometheusrule"),
+			RuleOptions: ruleOptions,
+			WarnOnly:    webhookWarnOnly,
+		}
+		if err = validator.SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "PrometheusRule")
+			os.Exit(1)
+		}
+	}
+	if scope.IsRestricted() {
+		// Clean up the absence alert rules for PrometheusRules that are no longer in scope
+		// since the operator was last started.
+		err = mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+			if err := reconciler.CleanUpOutOfScope(ctx); err != nil {
+				// We choose to absorb the error here since the operator works regardless.
+				setupLog.Error(err, "could not clean up absence alert rules for PrometheusRules that are out of scope")
+			}
+			return nil
+		}))
+		if err != nil {
+			setupLog.Error(err, "unable to add clean up for PrometheusRules that are out of scope")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -128,11 +458,34 @@ func main() {
 	version := bininfo.VersionOr("dev")
 	commit := bininfo.CommitOr("unknown")
 	date := bininfo.BuildDateOr("now")
-	setupLog.Info("starting manager", "version", version, "git-commit", commit, "build-date", date)
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	setupLog.Info("starting manager", "version", version, "git-commit", commit, "build-date", date, "dry-run", dryRun)
+	if err := mgr.Start(ctx); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
+	if restart.Load() {
+		// Exit with an error so that the operator is also restarted when it is not run
+		// with an unconditional restart policy.
+		setupLog.Info("exiting since the namespaces that match the namespace-selector flag have changed")
+		os.Exit(1)
+	}
+}
+
+// matchNothing returns a label selector that does not match any object.
+func matchNothing() labels.Selector {
+	const key = "absent-metrics-operator/managed-by"
+	exists, _ := labels.NewRequirement(key, selection.Exists, nil)
+	notExists, _ := labels.NewRequirement(key, selection.DoesNotExist, nil)
+	return labels.NewSelector().Add(*exists, *notExists)
+}
+
+// parseObjectKey parses a flag value in the format 'namespace/name'.
+func parseObjectKey(in string) (types.NamespacedName, error) {
+	ns, name, ok := strings.Cut(in, "/")
+	if !ok || ns == "" || name == "" {
+		return types.NamespacedName{}, errors.New("expected format 'namespace/name'")
+	}
+	return types.NamespacedName{Namespace: ns, Name: name}, nil
 }
 
 // labelsMap type is a wrapper around controllers.KeepLabel. It is used for the
@@ -159,3 +512,24 @@ func (lm *labelsMap) Set(in string) error {
 	*lm = labels
 	return nil
 }
+
+// stringList is used for flags that take a comma-separated list of values.
+type stringList []string
+
+// String implements the flag.Value interface.
+func (sl stringList) String() string {
+	return strings.Join(sl, ",")
+}
+
+// Set implements the flag.Value interface.
+func (sl *stringList) Set(in string) error {
+	var list stringList
+	for v := range strings.SplitSeq(in, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+
+	*sl = list
+	return nil
+}